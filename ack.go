@@ -0,0 +1,169 @@
+package rfm69
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// control byte flags, compatible with the LowPowerLab RFM69 and
+// RFM69_ATC libraries
+const (
+	RF69_CTL_SENDACK = 0x80
+	RF69_CTL_REQACK  = 0x40
+	RF69_CTL_RSSI    = 0x20 // ack requested with, or carrying, the receiver's RSSI
+)
+
+type ackWaiters struct {
+	mu      sync.Mutex
+	waiters map[byte][]ackWaiter
+}
+
+type ackWaiter struct {
+	ch     chan int
+	seq    byte
+	hasSeq bool
+}
+
+// add registers a wait for an ack from src, for the frame numbered seq if
+// hasSeq is set.
+func (a *ackWaiters) add(src, seq byte, hasSeq bool) chan int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.waiters == nil {
+		a.waiters = map[byte][]ackWaiter{}
+	}
+
+	ch := make(chan int, 1)
+	a.waiters[src] = append(a.waiters[src], ackWaiter{ch, seq, hasSeq})
+	return ch
+}
+
+func (a *ackWaiters) remove(src byte, ch chan int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ws := a.waiters[src]
+	for i, w := range ws {
+		if w.ch == ch {
+			a.waiters[src] = append(ws[:i:i], ws[i+1:]...)
+			return
+		}
+	}
+}
+
+// deliver hands an ack to the oldest sender waiting on src. An ack
+// echoing a sequence number only goes to a sender of that frame; one
+// without, as LowPowerLab nodes send, goes to any.
+func (a *ackWaiters) deliver(src, seq byte, hasSeq bool, rssi int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ws := a.waiters[src]
+	for i, w := range ws {
+		if hasSeq && (!w.hasSeq || w.seq != seq) {
+			continue
+		}
+		w.ch <- rssi
+		a.waiters[src] = append(ws[:i:i], ws[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// SendWithRetry sends msg requesting an ack, resending up to retries times
+// if none arrives within timeout. Acks are picked up by Rx, which must be
+// running. Broadcast and group frames are never acked.
+//
+// With sequence numbers on, acks echo the frame's number, so a late ack
+// for an earlier message can't complete this one.
+func (r *Radio) SendWithRetry(
+	toAddr byte,
+	msg []byte,
+	retries int,
+	timeout time.Duration,
+) error {
+	if toAddr == RF69_BROADCAST_ADDR || IsGroupAddr(toAddr) {
+		return errors.Wrapf(ErrNotAcked, "0x%02x", toAddr)
+	}
+	if retries < 0 {
+		return errors.Errorf("retries %d must not be negative", retries)
+	}
+	if !r.receiving.Load() {
+		return errors.New("rx must be running to receive acks")
+	}
+
+	ctl := byte(RF69_CTL_REQACK)
+	if r.atpc != nil {
+		ctl |= RF69_CTL_RSSI
+	}
+	ctl, msg = r.withSeq(ctl, msg)
+
+	var seq byte
+	hasSeq := ctl&RF69_CTL_SEQ != 0
+	if hasSeq {
+		seq = msg[0]
+	}
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			r.metrics.retry()
+		}
+
+		ch := r.acks.add(toAddr, seq, hasSeq)
+
+		r.mu.Lock()
+		err := r.sendFrame(toAddr, ctl, msg)
+		r.mu.Unlock()
+
+		if err != nil {
+			r.acks.remove(toAddr, ch)
+			return err
+		}
+
+		select {
+		case <-ch:
+			return nil
+		case <-time.After(timeout):
+			r.acks.remove(toAddr, ch)
+			if r.atpc != nil {
+				r.atpc.missed(toAddr)
+			}
+		}
+	}
+
+	return errors.Wrapf(ErrTimeout, "no ack from 0x%02x after %d attempts", toAddr, retries+1)
+}
+
+func (r *Radio) handleAck(p *Packet, ctl byte) {
+	rssi := 0
+	if ctl&RF69_CTL_RSSI != 0 && len(p.Payload) > 0 {
+		rssi = -int(p.Payload[0])
+		if r.atpc != nil {
+			r.atpc.update(p.Src, rssi)
+		}
+	}
+
+	r.log.Debug("ack", "src", p.Src, "rssi", p.RSSI, "reported_rssi", rssi)
+
+	if !r.acks.deliver(p.Src, p.Seq, p.HasSeq, rssi) {
+		r.log.Warn("unexpected ack", "src", p.Src, "seq", p.Seq)
+	}
+}
+
+func (r *Radio) sendAck(p *Packet, ctl byte) error {
+	var payload []byte
+	ackCtl := byte(RF69_CTL_SENDACK)
+
+	if ctl&RF69_CTL_RSSI != 0 {
+		ackCtl |= RF69_CTL_RSSI
+		payload = []byte{byte(-p.RSSI)}
+	}
+	if p.HasSeq {
+		ackCtl |= RF69_CTL_SEQ
+		payload = append([]byte{p.Seq}, payload...)
+	}
+
+	return r.sendFrame(p.Src, ackCtl, payload)
+}
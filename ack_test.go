@@ -0,0 +1,41 @@
+package rfm69
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAckMatching(t *testing.T) {
+	var a ackWaiters
+
+	// a later message from the same sender is waiting when a late ack for
+	// an earlier one arrives
+	ch := a.add(2, 8, true)
+	if a.deliver(2, 7, true, -50) {
+		t.Error("ack for seq 7 went to the sender of seq 8")
+	}
+	if !a.deliver(2, 8, true, -50) {
+		t.Fatal("ack for seq 8 not delivered")
+	}
+	if rssi := <-ch; rssi != -50 {
+		t.Errorf("rssi = %d", rssi)
+	}
+
+	// acks without a sequence number match any sender
+	ch = a.add(3, 9, true)
+	if !a.deliver(3, 0, false, 0) {
+		t.Error("ack without seq not delivered")
+	}
+	<-ch
+
+	if a.deliver(3, 0, false, 0) {
+		t.Error("ack delivered with nobody waiting")
+	}
+}
+
+func TestSendWithNegativeRetries(t *testing.T) {
+	r := NewRadio(nil)
+	if err := r.SendWithRetry(2, nil, -1, time.Millisecond); err == nil {
+		t.Error("negative retries accepted")
+	}
+}
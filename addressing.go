@@ -0,0 +1,112 @@
+package rfm69
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Multicast group addresses. Node addresses must stay below them.
+const (
+	RF69_GROUP_FIRST = 0xC0
+	RF69_GROUP_LAST  = 0xFE
+
+	MaxGroups = RF69_GROUP_LAST - RF69_GROUP_FIRST + 1
+)
+
+// GroupAddr returns the address frames for group id are sent to.
+func GroupAddr(id byte) byte {
+	return RF69_GROUP_FIRST + id
+}
+
+func IsGroupAddr(addr byte) bool {
+	return addr >= RF69_GROUP_FIRST && addr <= RF69_GROUP_LAST
+}
+
+// IsNodeAddr reports whether addr can be a node's own address: neither
+// RF69_BROADCAST_ADDR nor a group address.
+func IsNodeAddr(addr byte) bool {
+	return addr != RF69_BROADCAST_ADDR && !IsGroupAddr(addr)
+}
+
+// WithAddressFiltering makes Rx deliver only frames sent to this node, to
+// RF69_BROADCAST_ADDR, or to a group it has joined. Without it, Rx
+// delivers everything it hears.
+func WithAddressFiltering() Option {
+	return func(r *Radio) {
+		r.filtering = true
+	}
+}
+
+// JoinGroup starts delivering frames sent to GroupAddr(id). The chip can
+// only match its own and the broadcast address, so with any group joined
+// the filtering is done in software.
+func (r *Radio) JoinGroup(id byte) error {
+	if id >= MaxGroups {
+		return errors.Errorf("group %d out of range", id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.groups == nil {
+		r.groups = map[byte]bool{}
+	}
+	r.groups[GroupAddr(id)] = true
+	return r.applyAddressFilter()
+}
+
+func (r *Radio) LeaveGroup(id byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.groups, GroupAddr(id))
+	return r.applyAddressFilter()
+}
+
+// Groups returns the IDs of the groups joined.
+func (r *Radio) Groups() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]byte, 0, len(r.groups))
+	for addr := range r.groups {
+		ids = append(ids, addr-RF69_GROUP_FIRST)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// accepts is the software side of address filtering.
+func (r *Radio) accepts(dst byte) bool {
+	return !r.filtering ||
+		dst == r.fromAddr ||
+		dst == RF69_BROADCAST_ADDR ||
+		r.groups[dst]
+}
+
+// applyAddressFilter sets up the chip's filter: node and broadcast
+// addresses when that is all Rx should deliver, otherwise off.
+func (r *Radio) applyAddressFilter() error {
+	if !r.filtering {
+		return nil
+	}
+
+	filter := byte(RF_PACKET1_ADRSFILTERING_NODEBROADCAST)
+	if len(r.groups) > 0 {
+		filter = RF_PACKET1_ADRSFILTERING_OFF
+	}
+
+	cfg := r.configReg(REG_PACKETCONFIG1, 0)&^0x06 | filter
+	for _, kv := range [][2]byte{
+		{REG_NODEADRS, r.fromAddr},
+		{REG_BROADCASTADRS, RF69_BROADCAST_ADDR},
+		{REG_PACKETCONFIG1, cfg},
+	} {
+		if err := r.writeReg(kv[0], kv[1]); err != nil {
+			return errors.Wrap(err, "set address filter")
+		}
+		r.regs[kv[0]] = kv[1]
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Package app frames application messages in Packet payloads. Each
+// message type is registered under a one-byte ID and a version, and is
+// encoded with msgp after a two byte header:
+//
+//	0   type ID
+//	1   version
+//	2.. msgp encoding
+//
+// IDs below FirstUserType are reserved for the standard messages in this
+// package, and those above LastUserType for the protocols listed at
+// rfm69.ProtoFirst.
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	headerLen = 2
+
+	// FirstUserType and LastUserType bound the IDs free for
+	// applications' own types.
+	FirstUserType = 0x40
+	LastUserType  = rfm69.ProtoFirst - 1
+)
+
+var (
+	ErrUnknownType  = errors.New("unknown message type")
+	ErrUnregistered = errors.New("message type not registered")
+	ErrNoHandler    = errors.New("no handler for message type")
+)
+
+// VersionError reports a message whose version differs from the one
+// registered for its type.
+type VersionError struct {
+	ID        byte
+	Name      string
+	Got, Want byte
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s (type 0x%02x) version %d, want %d", e.Name, e.ID, e.Got, e.Want)
+}
+
+// Message is implemented by msgp generated types.
+type Message interface {
+	msgp.Marshaler
+	msgp.Unmarshaler
+	msgp.Sizer
+}
+
+type entry struct {
+	id      byte
+	version byte
+	name    string
+	new     func() Message
+	handler func(p *rfm69.Packet, m Message)
+}
+
+type Registry struct {
+	budget int
+
+	mu     sync.RWMutex
+	byID   map[byte]*entry
+	byType map[reflect.Type]*entry
+}
+
+// NewRegistry returns a registry for payloads of at most budget bytes,
+// such as the MaxPayload of the radio, or of a layer like secure or mesh.
+func NewRegistry(budget int) *Registry {
+	return &Registry{
+		budget: budget,
+		byID:   map[byte]*entry{},
+		byType: map[reflect.Type]*entry{},
+	}
+}
+
+// Register adds T under id, from FirstUserType to LastUserType. It
+// fails if even T's zero value is over the budget; a T with strings or
+// slices may still grow past it, which Encode reports.
+func Register[T any, P interface {
+	*T
+	Message
+}](r *Registry, id, version byte) error {
+	if id < FirstUserType || id > LastUserType {
+		return errors.Errorf("type 0x%02x is reserved", id)
+	}
+	return register[T, P](r, id, version)
+}
+
+func register[T any, P interface {
+	*T
+	Message
+}](r *Registry, id, version byte) error {
+	typ := reflect.TypeOf(P(nil))
+	size := P(new(T)).Msgsize()
+	if headerLen+size > r.budget {
+		return errors.Wrapf(rfm69.ErrPayloadTooLarge, "%s takes at least %d bytes, budget is %d", typ.Elem().Name(), headerLen+size, r.budget)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if prev, ok := r.byID[id]; ok {
+		return errors.Errorf("type 0x%02x already registered to %s", id, prev.name)
+	}
+	if _, ok := r.byType[typ]; ok {
+		return errors.Errorf("%s already registered", typ.Elem().Name())
+	}
+
+	e := &entry{
+		id:      id,
+		version: version,
+		name:    typ.Elem().Name(),
+		new:     func() Message { return P(new(T)) },
+	}
+	r.byID[id] = e
+	r.byType[typ] = e
+	return nil
+}
+
+// Handle routes received messages of type P to h, replacing any handler
+// already set.
+func Handle[T any, P interface {
+	*T
+	Message
+}](r *Registry, h func(p *rfm69.Packet, m P)) error {
+	typ := reflect.TypeOf(P(nil))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.byType[typ]
+	if !ok {
+		return errors.Wrap(ErrUnregistered, typ.Elem().Name())
+	}
+	e.handler = func(p *rfm69.Packet, m Message) { h(p, m.(P)) }
+	return nil
+}
+
+// Encode returns the payload carrying m.
+func (r *Registry) Encode(m Message) ([]byte, error) {
+	r.mu.RLock()
+	e, ok := r.byType[reflect.TypeOf(m)]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.Wrapf(ErrUnregistered, "%T", m)
+	}
+
+	buf, err := m.MarshalMsg([]byte{e.id, e.version})
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal %s", e.name)
+	}
+	if len(buf) > r.budget {
+		return nil, errors.Wrapf(rfm69.ErrPayloadTooLarge, "%s is %d bytes", e.name, len(buf))
+	}
+	return buf, nil
+}
+
+// Decode returns the message in payload.
+func (r *Registry) Decode(payload []byte) (Message, error) {
+	_, m, err := r.decode(payload)
+	return m, err
+}
+
+func (r *Registry) decode(payload []byte) (*entry, Message, error) {
+	if len(payload) < headerLen {
+		return nil, nil, errors.Wrap(ErrUnknownType, "short payload")
+	}
+
+	r.mu.RLock()
+	e, ok := r.byID[payload[0]]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, errors.Wrapf(ErrUnknownType, "0x%02x", payload[0])
+	}
+	if payload[1] != e.version {
+		return nil, nil, &VersionError{ID: e.id, Name: e.name, Got: payload[1], Want: e.version}
+	}
+
+	m := e.new()
+	if _, err := m.UnmarshalMsg(payload[headerLen:]); err != nil {
+		return nil, nil, errors.Wrapf(err, "unmarshal %s", e.name)
+	}
+	return e, m, nil
+}
+
+// Dispatch decodes p's payload and hands it to the handler for its type.
+// Unknown types, other versions and undecodable payloads are returned as
+// errors.
+func (r *Registry) Dispatch(p *rfm69.Packet) error {
+	e, m, err := r.decode(p.Payload)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	h := e.handler
+	r.mu.RUnlock()
+
+	if h == nil {
+		return errors.Wrap(ErrNoHandler, e.name)
+	}
+	h(p, m)
+	return nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/minor-industries/rfm69"
+)
+
+func TestDispatch(t *testing.T) {
+	r := NewRegistry(rfm69.RF69_MAX_DATA_LEN)
+	if err := RegisterStandard(r); err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Temperature
+	if err := Handle(r, func(p *rfm69.Packet, m *Temperature) { got = m }); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := r.Encode(&Temperature{Sensor: 2, Celsius: 21.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 9 {
+		t.Errorf("payload is %d bytes: %x", len(payload), payload)
+	}
+
+	if err := r.Dispatch(&rfm69.Packet{Src: 7, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || *got != (Temperature{Sensor: 2, Celsius: 21.5}) {
+		t.Errorf("handled %+v", got)
+	}
+
+	battery, _ := r.Encode(&Battery{Millivolts: 3300})
+	if err := r.Dispatch(&rfm69.Packet{Payload: battery}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("no handler: %v", err)
+	}
+
+	if err := r.Dispatch(&rfm69.Packet{Payload: []byte{0x7f, 1}}); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unknown type: %v", err)
+	}
+
+	newer := append([]byte{TypeTemperature, 2}, payload[headerLen:]...)
+	var verr *VersionError
+	if err := r.Dispatch(&rfm69.Packet{Payload: newer}); !errors.As(err, &verr) || verr.Got != 2 || verr.Want != 1 {
+		t.Errorf("newer version: %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry(rfm69.RF69_MAX_DATA_LEN)
+	if err := Register[Heartbeat](r, FirstUserType, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register[Battery](r, FirstUserType, 1); err == nil {
+		t.Error("registered an ID twice")
+	}
+	if err := Register[Heartbeat](r, FirstUserType+1, 1); err == nil {
+		t.Error("registered a type twice")
+	}
+	if _, err := r.Encode(&Humidity{}); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("encode unregistered: %v", err)
+	}
+
+	for _, id := range []byte{TypeHumidity, rfm69.ProtoRPCRequest} {
+		if err := Register[Humidity](r, id, 1); err == nil {
+			t.Errorf("registered reserved ID 0x%02x", id)
+		}
+	}
+
+	small := NewRegistry(6)
+	if err := Register[Temperature](small, FirstUserType, 1); !errors.Is(err, rfm69.ErrPayloadTooLarge) {
+		t.Errorf("over budget: %v", err)
+	}
+}
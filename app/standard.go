@@ -0,0 +1,50 @@
+package app
+
+//go:generate msgp
+
+// IDs of the standard message types.
+const (
+	TypeTemperature = 0x01
+	TypeHumidity    = 0x02
+	TypeBattery     = 0x03
+	TypeHeartbeat   = 0x04
+)
+
+//msgp:tuple Temperature Humidity Battery Heartbeat
+
+// Temperature is a reading from one of the node's sensors.
+type Temperature struct {
+	Sensor  uint8
+	Celsius float32
+}
+
+// Humidity is relative humidity from one of the node's sensors.
+type Humidity struct {
+	Sensor  uint8
+	Percent float32
+}
+
+type Battery struct {
+	Millivolts uint16
+}
+
+// Heartbeat tells the gateway a node is alive.
+type Heartbeat struct {
+	// Uptime is in seconds.
+	Uptime uint32
+	Boots  uint16
+}
+
+// RegisterStandard adds the standard message types to r.
+func RegisterStandard(r *Registry) error {
+	if err := register[Temperature](r, TypeTemperature, 1); err != nil {
+		return err
+	}
+	if err := register[Humidity](r, TypeHumidity, 1); err != nil {
+		return err
+	}
+	if err := register[Battery](r, TypeBattery, 1); err != nil {
+		return err
+	}
+	return register[Heartbeat](r, TypeHeartbeat, 1)
+}
@@ -0,0 +1,339 @@
+package app
+
+// Code generated by github.com/tinylib/msgp DO NOT EDIT.
+
+import (
+	"github.com/tinylib/msgp/msgp"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *Battery) DecodeMsg(dc *msgp.Reader) (err error) {
+	var zb0001 uint32
+	zb0001, err = dc.ReadArrayHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 1 {
+		err = msgp.ArrayError{Wanted: 1, Got: zb0001}
+		return
+	}
+	z.Millivolts, err = dc.ReadUint16()
+	if err != nil {
+		err = msgp.WrapError(err, "Millivolts")
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Battery) EncodeMsg(en *msgp.Writer) (err error) {
+	// array header, size 1
+	err = en.Append(0x91)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint16(z.Millivolts)
+	if err != nil {
+		err = msgp.WrapError(err, "Millivolts")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Battery) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 1
+	o = append(o, 0x91)
+	o = msgp.AppendUint16(o, z.Millivolts)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Battery) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 1 {
+		err = msgp.ArrayError{Wanted: 1, Got: zb0001}
+		return
+	}
+	z.Millivolts, bts, err = msgp.ReadUint16Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Millivolts")
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Battery) Msgsize() (s int) {
+	s = 1 + msgp.Uint16Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Heartbeat) DecodeMsg(dc *msgp.Reader) (err error) {
+	var zb0001 uint32
+	zb0001, err = dc.ReadArrayHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 2 {
+		err = msgp.ArrayError{Wanted: 2, Got: zb0001}
+		return
+	}
+	z.Uptime, err = dc.ReadUint32()
+	if err != nil {
+		err = msgp.WrapError(err, "Uptime")
+		return
+	}
+	z.Boots, err = dc.ReadUint16()
+	if err != nil {
+		err = msgp.WrapError(err, "Boots")
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Heartbeat) EncodeMsg(en *msgp.Writer) (err error) {
+	// array header, size 2
+	err = en.Append(0x92)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Uptime)
+	if err != nil {
+		err = msgp.WrapError(err, "Uptime")
+		return
+	}
+	err = en.WriteUint16(z.Boots)
+	if err != nil {
+		err = msgp.WrapError(err, "Boots")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Heartbeat) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 2
+	o = append(o, 0x92)
+	o = msgp.AppendUint32(o, z.Uptime)
+	o = msgp.AppendUint16(o, z.Boots)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Heartbeat) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 2 {
+		err = msgp.ArrayError{Wanted: 2, Got: zb0001}
+		return
+	}
+	z.Uptime, bts, err = msgp.ReadUint32Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Uptime")
+		return
+	}
+	z.Boots, bts, err = msgp.ReadUint16Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Boots")
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Heartbeat) Msgsize() (s int) {
+	s = 1 + msgp.Uint32Size + msgp.Uint16Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Humidity) DecodeMsg(dc *msgp.Reader) (err error) {
+	var zb0001 uint32
+	zb0001, err = dc.ReadArrayHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 2 {
+		err = msgp.ArrayError{Wanted: 2, Got: zb0001}
+		return
+	}
+	z.Sensor, err = dc.ReadUint8()
+	if err != nil {
+		err = msgp.WrapError(err, "Sensor")
+		return
+	}
+	z.Percent, err = dc.ReadFloat32()
+	if err != nil {
+		err = msgp.WrapError(err, "Percent")
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Humidity) EncodeMsg(en *msgp.Writer) (err error) {
+	// array header, size 2
+	err = en.Append(0x92)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint8(z.Sensor)
+	if err != nil {
+		err = msgp.WrapError(err, "Sensor")
+		return
+	}
+	err = en.WriteFloat32(z.Percent)
+	if err != nil {
+		err = msgp.WrapError(err, "Percent")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Humidity) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 2
+	o = append(o, 0x92)
+	o = msgp.AppendUint8(o, z.Sensor)
+	o = msgp.AppendFloat32(o, z.Percent)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Humidity) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 2 {
+		err = msgp.ArrayError{Wanted: 2, Got: zb0001}
+		return
+	}
+	z.Sensor, bts, err = msgp.ReadUint8Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Sensor")
+		return
+	}
+	z.Percent, bts, err = msgp.ReadFloat32Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Percent")
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Humidity) Msgsize() (s int) {
+	s = 1 + msgp.Uint8Size + msgp.Float32Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Temperature) DecodeMsg(dc *msgp.Reader) (err error) {
+	var zb0001 uint32
+	zb0001, err = dc.ReadArrayHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 2 {
+		err = msgp.ArrayError{Wanted: 2, Got: zb0001}
+		return
+	}
+	z.Sensor, err = dc.ReadUint8()
+	if err != nil {
+		err = msgp.WrapError(err, "Sensor")
+		return
+	}
+	z.Celsius, err = dc.ReadFloat32()
+	if err != nil {
+		err = msgp.WrapError(err, "Celsius")
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Temperature) EncodeMsg(en *msgp.Writer) (err error) {
+	// array header, size 2
+	err = en.Append(0x92)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint8(z.Sensor)
+	if err != nil {
+		err = msgp.WrapError(err, "Sensor")
+		return
+	}
+	err = en.WriteFloat32(z.Celsius)
+	if err != nil {
+		err = msgp.WrapError(err, "Celsius")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Temperature) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 2
+	o = append(o, 0x92)
+	o = msgp.AppendUint8(o, z.Sensor)
+	o = msgp.AppendFloat32(o, z.Celsius)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Temperature) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 2 {
+		err = msgp.ArrayError{Wanted: 2, Got: zb0001}
+		return
+	}
+	z.Sensor, bts, err = msgp.ReadUint8Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Sensor")
+		return
+	}
+	z.Celsius, bts, err = msgp.ReadFloat32Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Celsius")
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Temperature) Msgsize() (s int) {
+	s = 1 + msgp.Uint8Size + msgp.Float32Size
+	return
+}
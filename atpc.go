@@ -0,0 +1,118 @@
+package rfm69
+
+import "sync"
+
+// atpc adjusts the transmit power used for each peer so that the RSSI the
+// peer reports back in its acks stays near a target.
+type atpc struct {
+	target   int
+	deadband int
+	maxStep  int
+	lo, hi   int
+	initial  int
+
+	mu     sync.Mutex
+	levels map[byte]int
+}
+
+func newATPC(target int, lo, hi, initial int) *atpc {
+	return &atpc{
+		target:   target,
+		deadband: 2,
+		maxStep:  5,
+		lo:       lo,
+		hi:       hi,
+		initial:  min(max(initial, lo), hi),
+		levels:   map[byte]int{},
+	}
+}
+
+func (a *atpc) level(peer byte) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if level, ok := a.levels[peer]; ok {
+		return level
+	}
+	return a.initial
+}
+
+// update moves the peer's power towards the target. Received power
+// tracks transmit power dB for dB, so the error is applied directly,
+// limited to maxStep per ack.
+func (a *atpc) update(peer byte, rssi int) {
+	diff := a.target - rssi
+	if diff >= -a.deadband && diff <= a.deadband {
+		return
+	}
+	a.adjust(peer, min(max(diff, -a.maxStep), a.maxStep))
+}
+
+func (a *atpc) missed(peer byte) {
+	a.adjust(peer, a.maxStep)
+}
+
+func (a *atpc) adjust(peer byte, delta int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	level, ok := a.levels[peer]
+	if !ok {
+		level = a.initial
+	}
+	a.levels[peer] = min(max(level+delta, a.lo), a.hi)
+}
+
+func (a *atpc) snapshot() map[byte]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make(map[byte]int, len(a.levels))
+	for peer, level := range a.levels {
+		result[peer] = level
+	}
+	return result
+}
+
+// peerPower is PeerPower for callers holding r.mu.
+func (r *Radio) peerPower(peer byte) int {
+	level := r.txPower
+	if r.atpc != nil {
+		level = r.atpc.level(peer)
+	}
+	if r.powerLimit != nil {
+		level = min(level, *r.powerLimit)
+	}
+	return level
+}
+
+// LimitPower caps the transmit power of every frame at dBm, whatever
+// SetPowerDBm or ATPC would otherwise use, until restore is called.
+func (r *Radio) LimitPower(dBm int) (restore func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := r.powerLimit
+	r.powerLimit = &dBm
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.powerLimit = prev
+	}
+}
+
+// PeerPower returns the transmit power, in dBm, used for frames to peer.
+func (r *Radio) PeerPower(peer byte) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.peerPower(peer)
+}
+
+// PeerPowers returns the power level of every peer ATPC has adjusted.
+func (r *Radio) PeerPowers() map[byte]int {
+	if r.atpc == nil {
+		return nil
+	}
+	return r.atpc.snapshot()
+}
@@ -0,0 +1,37 @@
+package rfm69
+
+import "testing"
+
+func TestATPC(t *testing.T) {
+	a := newATPC(-80, -2, 20, 13)
+
+	if got := a.level(1); got != 13 {
+		t.Fatalf("initial level = %d, want 13", got)
+	}
+
+	a.update(1, -60) // far too loud: step down by at most 5
+	if got := a.level(1); got != 8 {
+		t.Errorf("after loud ack level = %d, want 8", got)
+	}
+
+	a.update(1, -81) // inside the deadband
+	if got := a.level(1); got != 8 {
+		t.Errorf("after ack near target level = %d, want 8", got)
+	}
+
+	a.update(1, -84)
+	if got := a.level(1); got != 12 {
+		t.Errorf("after quiet ack level = %d, want 12", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		a.missed(1)
+	}
+	if got := a.level(1); got != 20 {
+		t.Errorf("after missed acks level = %d, want 20", got)
+	}
+
+	if got := a.level(2); got != 13 {
+		t.Errorf("untouched peer level = %d, want 13", got)
+	}
+}
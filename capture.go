@@ -0,0 +1,404 @@
+package rfm69
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Captures are pcapng files with one interface of link type USER0. Each
+// packet starts with an 8 byte header followed by the frame exactly as it
+// goes over the air (length, dst, src, ctl, payload):
+//
+//	0     version (1)
+//	1     direction (0 = rx, 1 = tx)
+//	2..3  rssi in dBm, int16 little endian
+//	4..7  carrier frequency in Hz, uint32 little endian
+const (
+	LinkTypeRFM69 = 147 // LINKTYPE_USER0
+
+	captureVersion   = 1
+	captureHeaderLen = 8
+	captureSnapLen   = captureHeaderLen + 1 + 255
+)
+
+const (
+	blockSHB = 0x0A0D0D0A
+	blockIDB = 0x00000001
+	blockEPB = 0x00000006
+
+	byteOrderMagic = 0x1A2B3C4D
+
+	optEndOfOpt = 0
+	optTsResol  = 9
+)
+
+type Direction byte
+
+const (
+	DirectionRx Direction = 0
+	DirectionTx Direction = 1
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionRx:
+		return "rx"
+	case DirectionTx:
+		return "tx"
+	default:
+		return fmt.Sprintf("Direction(%d)", byte(d))
+	}
+}
+
+type CaptureRecord struct {
+	Time      time.Time
+	Direction Direction
+	RSSI      int
+	Frequency uint32
+
+	// Frame holds the on-air bytes, starting with the length byte.
+	Frame []byte
+}
+
+func (rec *CaptureRecord) Packet() (*Packet, error) {
+	f := rec.Frame
+	if len(f) < 4 || int(f[0])+1 != len(f) {
+		return nil, errors.New("malformed frame")
+	}
+
+	p := &Packet{
+		Src:     f[2],
+		Dst:     f[1],
+		RSSI:    rec.RSSI,
+		Payload: append([]byte(nil), f[4:]...),
+	}
+	splitSeq(p, f[3])
+
+	return p, nil
+}
+
+type CaptureWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewCaptureWriter writes the section and interface headers to w. When w
+// is a file opened for appending this starts a new pcapng section, which
+// readers, including CaptureReader, handle transparently.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	c := &CaptureWriter{w: w}
+
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint16(shb[6:], 0)
+	binary.LittleEndian.PutUint64(shb[8:], math.MaxUint64) // section length unknown
+	if err := c.writeBlock(blockSHB, shb); err != nil {
+		return nil, errors.Wrap(err, "write section header")
+	}
+
+	idb := make([]byte, 8, 20)
+	binary.LittleEndian.PutUint16(idb[0:], LinkTypeRFM69)
+	binary.LittleEndian.PutUint32(idb[4:], captureSnapLen)
+	idb = appendOption(idb, optTsResol, []byte{9}) // nanoseconds
+	idb = appendOption(idb, optEndOfOpt, nil)
+	if err := c.writeBlock(blockIDB, idb); err != nil {
+		return nil, errors.Wrap(err, "write interface description")
+	}
+
+	return c, nil
+}
+
+func WithCapture(c *CaptureWriter) Option {
+	return func(r *Radio) {
+		r.capture = c
+	}
+}
+
+func (c *CaptureWriter) Write(rec *CaptureRecord) error {
+	data := make([]byte, captureHeaderLen, captureHeaderLen+len(rec.Frame))
+	data[0] = captureVersion
+	data[1] = byte(rec.Direction)
+	binary.LittleEndian.PutUint16(data[2:], uint16(int16(rec.RSSI)))
+	binary.LittleEndian.PutUint32(data[4:], rec.Frequency)
+	data = append(data, rec.Frame...)
+
+	ts := uint64(rec.Time.UnixNano())
+
+	body := make([]byte, 20, 20+len(data)+3)
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface id
+	binary.LittleEndian.PutUint32(body[4:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(data)))
+	body = append(body, data...)
+	body = append(body, make([]byte, pad4(len(data)))...)
+
+	return c.writeBlock(blockEPB, body)
+}
+
+func (c *CaptureWriter) writeBlock(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+
+	buf := make([]byte, 0, total)
+	buf = binary.LittleEndian.AppendUint32(buf, blockType)
+	buf = binary.LittleEndian.AppendUint32(buf, total)
+	buf = append(buf, body...)
+	buf = binary.LittleEndian.AppendUint32(buf, total)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.w.Write(buf)
+	return err
+}
+
+func appendOption(b []byte, code uint16, val []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(val)))
+	b = append(b, val...)
+	return append(b, make([]byte, pad4(len(val)))...)
+}
+
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+type captureInterface struct {
+	linkType uint16
+	tsPerSec uint64
+}
+
+type CaptureReader struct {
+	r      *bufio.Reader
+	order  binary.ByteOrder
+	ifaces []captureInterface
+}
+
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next rfm69 record, skipping blocks and interfaces it
+// does not understand. It returns io.EOF at the end of the capture.
+func (c *CaptureReader) Next() (*CaptureRecord, error) {
+	for {
+		blockType, body, err := c.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case blockSHB:
+			c.ifaces = nil
+		case blockIDB:
+			if len(body) < 8 {
+				return nil, errors.New("short interface description")
+			}
+			iface, err := parseInterface(c.order, body)
+			if err != nil {
+				return nil, err
+			}
+			c.ifaces = append(c.ifaces, iface)
+		case blockEPB:
+			rec, err := c.parsePacket(body)
+			if err != nil {
+				return nil, err
+			}
+			if rec != nil {
+				return rec, nil
+			}
+		}
+	}
+}
+
+func (c *CaptureReader) readBlock() (uint32, []byte, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errors.Wrap(err, "truncated block header")
+		}
+		return 0, nil, err
+	}
+
+	if binary.LittleEndian.Uint32(hdr) == blockSHB {
+		magic, err := c.r.Peek(4)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "read byte order magic")
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == byteOrderMagic:
+			c.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == byteOrderMagic:
+			c.order = binary.BigEndian
+		default:
+			return 0, nil, errors.New("bad byte order magic")
+		}
+	}
+	if c.order == nil {
+		return 0, nil, errors.New("not a pcapng file")
+	}
+
+	blockType := c.order.Uint32(hdr[0:])
+	total := c.order.Uint32(hdr[4:])
+	if total < 12 || total%4 != 0 {
+		return 0, nil, fmt.Errorf("bad block length %d", total)
+	}
+
+	rest := make([]byte, total-8)
+	if _, err := io.ReadFull(c.r, rest); err != nil {
+		return 0, nil, errors.Wrap(err, "truncated block")
+	}
+
+	return blockType, rest[:len(rest)-4], nil
+}
+
+// parseInterface reads an interface description, rejecting a timestamp
+// resolution too fine to count in 64 bits.
+func parseInterface(order binary.ByteOrder, body []byte) (captureInterface, error) {
+	iface := captureInterface{
+		linkType: order.Uint16(body[0:]),
+		tsPerSec: 1_000_000,
+	}
+
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := order.Uint16(opts[0:])
+		n := int(order.Uint16(opts[2:]))
+		if code == optEndOfOpt || 4+n > len(opts) {
+			break
+		}
+		if code == optTsResol && n >= 1 {
+			res := opts[4]
+			exp := int(res & 0x7F)
+			switch {
+			case res&0x80 == 0 && exp <= 19:
+				iface.tsPerSec = 1
+				for i := 0; i < exp; i++ {
+					iface.tsPerSec *= 10
+				}
+			case res&0x80 != 0 && exp <= 63:
+				iface.tsPerSec = 1 << exp
+			default:
+				return captureInterface{}, fmt.Errorf("bad timestamp resolution 0x%02x", res)
+			}
+		}
+		opts = opts[min(4+n+pad4(n), len(opts)):]
+	}
+
+	return iface, nil
+}
+
+func (c *CaptureReader) parsePacket(body []byte) (*CaptureRecord, error) {
+	if len(body) < 20 {
+		return nil, errors.New("short packet block")
+	}
+
+	ifaceID := c.order.Uint32(body[0:])
+	if int(ifaceID) >= len(c.ifaces) {
+		return nil, fmt.Errorf("packet for unknown interface %d", ifaceID)
+	}
+	iface := c.ifaces[ifaceID]
+	if iface.linkType != LinkTypeRFM69 {
+		return nil, nil
+	}
+
+	ts := uint64(c.order.Uint32(body[4:]))<<32 | uint64(c.order.Uint32(body[8:]))
+	capLen := int(c.order.Uint32(body[12:]))
+	if 20+capLen > len(body) {
+		return nil, errors.New("packet block shorter than captured length")
+	}
+
+	data := body[20 : 20+capLen]
+	if len(data) < captureHeaderLen || data[0] != captureVersion {
+		return nil, errors.New("unsupported capture header")
+	}
+
+	// 128 bit, as the remainder in nanoseconds can overflow
+	hi, lo := bits.Mul64(ts%iface.tsPerSec, uint64(time.Second))
+	nsec, _ := bits.Div64(hi, lo, iface.tsPerSec)
+
+	// the header fields are always little endian, whatever the section
+	return &CaptureRecord{
+		Time:      time.Unix(int64(ts/iface.tsPerSec), int64(nsec)),
+		Direction: Direction(data[1]),
+		RSSI:      int(int16(binary.LittleEndian.Uint16(data[2:]))),
+		Frequency: binary.LittleEndian.Uint32(data[4:]),
+		Frame:     append([]byte(nil), data[captureHeaderLen:]...),
+	}, nil
+}
+
+// Replay sends the received frames in a capture to out. With realtime set
+// it keeps the original spacing between frames.
+func Replay(
+	ctx context.Context,
+	rd *CaptureReader,
+	out chan<- *Packet,
+	realtime bool,
+) error {
+	var last time.Time
+
+	for {
+		rec, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Direction != DirectionRx {
+			continue
+		}
+
+		p, err := rec.Packet()
+		if err != nil {
+			return err
+		}
+
+		if realtime && !last.IsZero() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(rec.Time.Sub(last)):
+			}
+		}
+		last = rec.Time
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- p:
+		}
+	}
+}
+
+func (r *Radio) frequency() uint32 {
+	frf := uint64(r.configReg(REG_FRFMSB, RF_FRFMSB_915))<<16 |
+		uint64(r.configReg(REG_FRFMID, RF_FRFMID_915))<<8 |
+		uint64(r.configReg(REG_FRFLSB, RF_FRFLSB_915))
+	return uint32(frf * fxosc >> 19)
+}
+
+func (r *Radio) captureFrame(dir Direction, rssi int, frame []byte) {
+	if r.capture == nil {
+		return
+	}
+
+	if err := r.capture.Write(&CaptureRecord{
+		Time:      time.Now(),
+		Direction: dir,
+		RSSI:      rssi,
+		Frequency: r.frequency(),
+		Frame:     frame,
+	}); err != nil {
+		r.log.Warn("capture failed", "err", err)
+	}
+}
@@ -0,0 +1,54 @@
+package rfm69
+
+import "time"
+
+// Clock is the time source a Radio timestamps frames and times its waits
+// on the chip with.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// WithClock sets the clock used for Packet.RxTime, SendTimestamped and
+// duplicate detection. Waits on the chip keep to the system's monotonic
+// clock, since a stepped or virtual clock would make them fire early or
+// never.
+func WithClock(c Clock) Option {
+	return func(r *Radio) {
+		r.clock = c
+	}
+}
+
+// SendTimestamped sends msg, first calling stamp with the time by the
+// radio's clock, once the chip is ready to transmit and the frame is about
+// to be written to the FIFO. stamp may fill in msg, which has been copied,
+// so an embedded timestamp is within an SPI transfer of the frame going on
+// air. The frame is received Airtime(len(msg)) later.
+func (r *Radio) SendTimestamped(toAddr byte, msg []byte, stamp func(msg []byte, now time.Time)) error {
+	msg = append([]byte(nil), msg...)
+	ctl, frame := r.withSeq(0x00, msg)
+	msg = frame[len(frame)-len(msg):]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sendStamped(toAddr, ctl, frame, func(now time.Time) {
+		stamp(msg, now)
+	})
+}
+
+// edgeTime is when the most recent DIO0 edge was seen.
+func (r *Radio) edgeTime() time.Time {
+	if t := r.lastEdge.Load(); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
+
+// Clock returns the clock set by WithClock.
+func (r *Radio) Clock() Clock {
+	return r.clock
+}
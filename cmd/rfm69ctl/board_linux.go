@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/spidev"
+)
+
+func openSpidev(g *globalFlags) (rfm69.Board, error) {
+	cfg := spidev.DefaultConfig
+	cfg.Device = g.device
+	cfg.Reset = g.resetPin
+	cfg.DIO0 = g.dio0Pin
+	return spidev.Open(cfg)
+}
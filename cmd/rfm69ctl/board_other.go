@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+func openSpidev(*globalFlags) (rfm69.Board, error) {
+	return nil, errors.New("spidev is only available on linux")
+}
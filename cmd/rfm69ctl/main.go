@@ -0,0 +1,522 @@
+// Command rfm69ctl sets up, exercises and inspects an RFM69 module.
+//
+//	rfm69ctl [flags] <command> [args]
+//
+// Commands are setup, send, listen, regs, temp, scan, power, serve and
+// gateway.
+// Run a command with -h for its own flags.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/gateway"
+	"github.com/minor-industries/rfm69/remote"
+	"github.com/pkg/errors"
+)
+
+type globalFlags struct {
+	board    string
+	remote   string
+	device   string
+	resetPin int
+	dio0Pin  int
+
+	freq    uint
+	bitRate int
+	network uint
+	addr    uint
+	power   int
+	key     string
+	seq     bool
+	filter  bool
+	groups  string
+	verbose bool
+}
+
+var commands = map[string]func(ctx context.Context, g *globalFlags, args []string) error{
+	"setup":   cmdSetup,
+	"send":    cmdSend,
+	"listen":  cmdListen,
+	"regs":    cmdRegs,
+	"temp":    cmdTemp,
+	"scan":    cmdScan,
+	"power":   cmdPower,
+	"serve":   cmdServe,
+	"gateway": cmdGateway,
+}
+
+func main() {
+	g := &globalFlags{}
+
+	fs := flag.NewFlagSet("rfm69ctl", flag.ExitOnError)
+	fs.StringVar(&g.board, "board", "spidev", "board backend: spidev, sim or remote")
+	fs.StringVar(&g.remote, "remote", "localhost:6969", "server address for the remote board")
+	fs.StringVar(&g.device, "device", "/dev/spidev0.0", "spidev device")
+	fs.IntVar(&g.resetPin, "reset-pin", 25, "GPIO number of RESET")
+	fs.IntVar(&g.dio0Pin, "dio0-pin", 24, "GPIO number of DIO0")
+	fs.UintVar(&g.freq, "freq", 0, "carrier frequency in Hz (default: the 433 MHz band)")
+	fs.IntVar(&g.bitRate, "bitrate", rfm69.DefaultConfig.BitRate, "bit rate in bits/s")
+	fs.UintVar(&g.network, "network", uint(rfm69.DefaultConfig.NetworkID), "network ID")
+	fs.UintVar(&g.addr, "addr", 1, "node address")
+	fs.IntVar(&g.power, "power", 13, "transmit power in dBm")
+	fs.StringVar(&g.key, "key", "", "16 byte AES key, as text")
+	fs.BoolVar(&g.seq, "seq", false, "number sent frames so receivers can drop duplicates")
+	fs.BoolVar(&g.filter, "filter", false, "only receive frames for this node, broadcasts and joined groups")
+	fs.StringVar(&g.groups, "groups", "", "comma separated multicast group IDs to join; implies -filter")
+	fs.BoolVar(&g.verbose, "v", false, "debug logging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rfm69ctl [flags] setup|send|listen|regs|temp|scan|power|serve|gateway [args]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := g.check(); err != nil {
+		fmt.Fprintln(os.Stderr, "rfm69ctl:", err)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd(ctx, g, fs.Args()[1:]); err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, "rfm69ctl:", err)
+		os.Exit(1)
+	}
+}
+
+// check rejects flag values too large for the fields they go in.
+func (g *globalFlags) check() error {
+	if g.network > 0xff {
+		return fmt.Errorf("network %d out of range 0-255", g.network)
+	}
+	if g.addr > 0xff {
+		return fmt.Errorf("addr %d out of range 0-255", g.addr)
+	}
+	if g.bitRate < 0 || g.bitRate > 32_000_000 || g.bitRate != 0 && 32_000_000/g.bitRate > 0xffff {
+		return fmt.Errorf("bitrate %d bit/s out of range 489-32000000", g.bitRate)
+	}
+	if g.freq > math.MaxUint32 {
+		return fmt.Errorf("freq %d Hz out of range", g.freq)
+	}
+	return nil
+}
+
+func openBoard(g *globalFlags) (rfm69.Board, error) {
+	switch g.board {
+	case "spidev":
+		return openSpidev(g)
+	case "sim":
+		return openSim(g)
+	case "remote":
+		return remote.Dial(g.remote)
+	default:
+		return nil, fmt.Errorf("unknown board %q", g.board)
+	}
+}
+
+// open builds a radio on the chosen board and runs Setup.
+func open(g *globalFlags) (*rfm69.Radio, error) {
+	board, err := openBoard(g)
+	if err != nil {
+		return nil, errors.Wrap(err, "open board")
+	}
+
+	opts := []rfm69.Option{
+		rfm69.WithAddress(byte(g.addr)),
+		rfm69.WithTxPower(g.power),
+		rfm69.WithConfig(config(g)),
+		rfm69.WithLogger(logger(g)),
+	}
+	if g.seq {
+		opts = append(opts, rfm69.WithSequenceNumbers())
+	}
+	if g.filter || g.groups != "" {
+		opts = append(opts, rfm69.WithAddressFiltering())
+	}
+	radio := rfm69.NewRadio(board, opts...)
+
+	if err := radio.Setup(); err != nil {
+		return nil, errors.Wrap(err, "setup")
+	}
+	if err := radio.SetPowerDBm(g.power); err != nil {
+		return nil, errors.Wrap(err, "set power")
+	}
+	if g.key != "" {
+		if err := radio.SetEncryptionKey([]byte(g.key)); err != nil {
+			return nil, errors.Wrap(err, "set encryption key")
+		}
+	}
+	if g.groups != "" {
+		for _, s := range strings.Split(g.groups, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(s), 0, 8)
+			if err != nil {
+				return nil, errors.Wrapf(err, "group %q", s)
+			}
+			if err := radio.JoinGroup(byte(id)); err != nil {
+				return nil, errors.Wrap(err, "join group")
+			}
+		}
+	}
+
+	return radio, nil
+}
+
+func logger(g *globalFlags) *slog.Logger {
+	level := slog.LevelInfo
+	if g.verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+func config(g *globalFlags) rfm69.Config {
+	return rfm69.Config{
+		Band:      rfm69.RF69_433MHZ,
+		NetworkID: byte(g.network),
+		BitRate:   g.bitRate,
+		Frequency: uint32(g.freq),
+	}
+}
+
+func cmdSetup(_ context.Context, g *globalFlags, args []string) error {
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+	if err := radio.VerifyConfig(); err != nil {
+		return err
+	}
+
+	fmt.Printf("version   0x%02x (%s)\n", radio.Version(), radio.Variant())
+	fmt.Printf("frequency %d Hz\n", radio.Frequency())
+	fmt.Printf("bitrate   %d bit/s\n", radio.BitRate())
+	return nil
+}
+
+func cmdSend(ctx context.Context, g *globalFlags, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	isHex := fs.Bool("hex", false, "payload is hex")
+	retries := fs.Int("ack", -1, "request an ack, resending up to this many times")
+	timeout := fs.Duration("ack-timeout", 100*time.Millisecond, "time to wait for each ack")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rfm69ctl send [flags] <dst> <payload>\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	dst, err := strconv.ParseUint(fs.Arg(0), 0, 8)
+	if err != nil {
+		return errors.Wrap(err, "parse destination")
+	}
+
+	payload := []byte(fs.Arg(1))
+	if *isHex {
+		if payload, err = hex.DecodeString(fs.Arg(1)); err != nil {
+			return errors.Wrap(err, "decode payload")
+		}
+	}
+
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+
+	if *retries < 0 {
+		return radio.SendFrame(byte(dst), payload)
+	}
+
+	// acks only arrive while receiving
+	rxCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rxErr := make(chan error, 1)
+	go func() { rxErr <- radio.RxContext(rxCtx, make(chan *rfm69.Packet, 16)) }()
+	if err := waitReceiving(radio, rxErr); err != nil {
+		return err
+	}
+
+	if err := radio.SendWithRetry(byte(dst), payload, *retries, *timeout); err != nil {
+		return err
+	}
+	fmt.Println("acked")
+	return nil
+}
+
+// waitReceiving waits for a just started Rx to get going.
+func waitReceiving(radio *rfm69.Radio, rxErr <-chan error) error {
+	deadline := time.After(time.Second)
+	for !radio.Receiving() {
+		select {
+		case err := <-rxErr:
+			return errors.Wrap(err, "start rx")
+		case <-deadline:
+			return errors.New("rx did not start")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+type listenRecord struct {
+	Time    time.Time `json:"time"`
+	Src     byte      `json:"src"`
+	Dst     byte      `json:"dst"`
+	RSSI    int       `json:"rssi"`
+	Payload string    `json:"payload"`
+}
+
+func cmdListen(ctx context.Context, g *globalFlags, args []string) error {
+	fs := flag.NewFlagSet("listen", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print one JSON object per packet")
+	logPath := fs.String("log", "", "also append packets to this packet stream file")
+	_ = fs.Parse(args)
+
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+
+	var pw *rfm69.PacketWriter
+	if *logPath != "" {
+		var f *os.File
+		pw, f, err = rfm69.AppendPacketFile(*logPath, rfm69.NewStreamHeader(byte(g.addr), config(g)))
+		if err != nil {
+			return errors.Wrap(err, "open packet log")
+		}
+		defer f.Close()
+	}
+
+	out := make(chan *rfm69.Packet, 16)
+	errCh := make(chan error, 1)
+	go func() { errCh <- radio.RxContext(ctx, out) }()
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case p := <-out:
+			if pw != nil {
+				if err := pw.Write(p); err != nil {
+					return errors.Wrap(err, "write packet log")
+				}
+			}
+
+			now := time.Now()
+			if *asJSON {
+				if err := enc.Encode(listenRecord{
+					Time:    now,
+					Src:     p.Src,
+					Dst:     p.Dst,
+					RSSI:    p.RSSI,
+					Payload: hex.EncodeToString(p.Payload),
+				}); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s %3d -> %3d %4d dBm  %s  %q\n",
+				now.Format("15:04:05.000"), p.Src, p.Dst, p.RSSI,
+				hex.EncodeToString(p.Payload), p.Payload,
+			)
+		}
+	}
+}
+
+func cmdRegs(_ context.Context, g *globalFlags, args []string) error {
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+
+	regs, err := radio.DumpRegisters()
+	if err != nil {
+		return err
+	}
+	for _, reg := range regs {
+		fmt.Printf("0x%02x 0x%02x  %s\n", reg.Addr, reg.Value, rfm69.FormatRegister(reg.Addr, reg.Value))
+	}
+	return nil
+}
+
+func cmdTemp(_ context.Context, g *globalFlags, args []string) error {
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+
+	temp, err := radio.ReadTemperature()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d °C\n", temp)
+	return nil
+}
+
+func cmdScan(ctx context.Context, g *globalFlags, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	from := fs.Uint("from", 433_050_000, "first frequency in Hz")
+	to := fs.Uint("to", 434_790_000, "last frequency in Hz")
+	step := fs.Uint("step", 100_000, "step in Hz")
+	dwell := fs.Duration("dwell", 20*time.Millisecond, "time on each channel")
+	_ = fs.Parse(args)
+
+	if *step == 0 {
+		return errors.New("step must be positive")
+	}
+	if *from > math.MaxUint32 || *to > math.MaxUint32 {
+		return errors.New("frequency out of range")
+	}
+
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+	if err := radio.SetMode(rfm69.ModeRx); err != nil {
+		return err
+	}
+	defer radio.SetMode(rfm69.ModeStandby)
+
+	for hz := *from; hz <= *to; hz += *step {
+		if err := radio.SetFrequency(uint32(hz)); err != nil {
+			return err
+		}
+
+		peak := -128
+		deadline := time.Now().Add(*dwell)
+		for time.Now().Before(deadline) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			rssi, err := radio.ReadRSSI()
+			if err != nil {
+				return err
+			}
+			peak = max(peak, rssi)
+			time.Sleep(time.Millisecond)
+		}
+
+		fmt.Printf("%10d Hz %4d dBm\n", hz, peak)
+	}
+	return nil
+}
+
+func cmdPower(_ context.Context, g *globalFlags, args []string) error {
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+
+	lo, hi := radio.Variant().PowerRange()
+	if len(args) == 0 {
+		fmt.Printf("%s: %d to %d dBm\n", radio.Variant(), lo, hi)
+		return nil
+	}
+
+	dBm, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errors.Wrap(err, "parse power")
+	}
+	if err := radio.SetPowerDBm(dBm); err != nil {
+		return err
+	}
+
+	pa, err := radio.ReadRegister(rfm69.REG_PALEVEL)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d dBm  %s\n", dBm, rfm69.FormatRegister(rfm69.REG_PALEVEL, pa))
+	return nil
+}
+
+// cmdServe exposes the board, without setting it up, to remote clients.
+func cmdServe(ctx context.Context, g *globalFlags, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:6969", "address to listen on; the board is served without authentication")
+	_ = fs.Parse(args)
+
+	board, err := openBoard(g)
+	if err != nil {
+		return errors.Wrap(err, "open board")
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving %s board on %s\n", g.board, ln.Addr())
+	return remote.NewServer(board).Serve(ln)
+}
+
+// cmdGateway bridges the radio to an MQTT broker.
+func cmdGateway(ctx context.Context, g *globalFlags, args []string) error {
+	cfg := gateway.DefaultConfig
+
+	fs := flag.NewFlagSet("gateway", flag.ExitOnError)
+	fs.StringVar(&cfg.Broker, "broker", cfg.Broker, "MQTT broker URL")
+	fs.StringVar(&cfg.ClientID, "client-id", cfg.ClientID, "MQTT client ID")
+	fs.StringVar(&cfg.Username, "username", "", "MQTT username")
+	fs.StringVar(&cfg.RxTopic, "rx-topic", cfg.RxTopic, "topic template for received packets")
+	fs.StringVar(&cfg.TxTopic, "tx-topic", cfg.TxTopic, "topic template for packets to send")
+	encoding := fs.String("encoding", cfg.Encoding.String(), "msgp, json or raw")
+	qos := fs.Uint("qos", uint(cfg.QoS), "MQTT QoS, 0 to 2")
+	_ = fs.Parse(args)
+
+	var err error
+	if cfg.Encoding, err = gateway.ParseEncoding(*encoding); err != nil {
+		return err
+	}
+	if *qos > 2 {
+		return fmt.Errorf("bad qos %d", *qos)
+	}
+	cfg.QoS = byte(*qos)
+	cfg.Password = os.Getenv("MQTT_PASSWORD")
+	cfg.Network = byte(g.network)
+
+	radio, err := open(g)
+	if err != nil {
+		return err
+	}
+	cfg.Log = logger(g)
+
+	in := make(chan *rfm69.Packet, 16)
+	errCh := make(chan error, 1)
+	go func() { errCh <- radio.RxContext(ctx, in) }()
+	go func() { errCh <- gateway.New(cfg, radio).Run(ctx, in) }()
+
+	return <-errCh
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+)
+
+const chatterAddr = 99
+
+// openSim returns a simulated board sharing the air with a peer that
+// sends a counter every second and acks anything sent to it.
+func openSim(g *globalFlags) (rfm69.Board, error) {
+	m := sim.NewMedium()
+	board := m.NewBoard()
+
+	peer := rfm69.NewRadio(m.NewBoard(),
+		rfm69.WithAddress(chatterAddr),
+		rfm69.WithConfig(config(g)),
+	)
+	if err := peer.Setup(); err != nil {
+		return nil, err
+	}
+	if g.key != "" {
+		if err := peer.SetEncryptionKey([]byte(g.key)); err != nil {
+			return nil, err
+		}
+	}
+
+	go func() { _ = peer.Rx(make(chan *rfm69.Packet, 16)) }()
+	go func() {
+		for i := 0; ; i++ {
+			time.Sleep(time.Second)
+			_ = peer.SendFrame(byte(g.addr), []byte(fmt.Sprintf("chatter %d", i)))
+		}
+	}()
+
+	return board, nil
+}
@@ -1,5 +1,7 @@
 package rfm69
 
+import "github.com/pkg/errors"
+
 /*
 
 frfMSB = {RF69_315MHZ: RF_FRFMSB_315, RF69_433MHZ: RF_FRFMSB_433,
@@ -31,10 +33,29 @@ var frfLSB = map[byte]byte{
 	RF69_915MHZ: RF_FRFLSB_915,
 }
 
-func getConfig(
-	freqBand byte,
-	networkID byte,
-) [][2]byte {
+// validate rejects settings that don't fit the registers. A zero BitRate
+// is left to getConfig's default.
+func (cfg Config) validate() error {
+	if cfg.BitRate != 0 && (cfg.BitRate < 0 || cfg.BitRate > fxosc || fxosc/cfg.BitRate > 0xffff) {
+		return errors.Wrapf(ErrBadConfig, "bit rate %d outside %d-%d", cfg.BitRate, fxosc/0xffff+1, fxosc)
+	}
+	if _, ok := frfMSB[cfg.Band]; !ok && cfg.Frequency == 0 {
+		return errors.Wrapf(ErrBadConfig, "unknown band %d", cfg.Band)
+	}
+	return nil
+}
+
+func getConfig(cfg Config) [][2]byte {
+	if cfg.BitRate == 0 {
+		cfg.BitRate = DefaultConfig.BitRate
+	}
+	bitRate := fxosc / cfg.BitRate
+
+	frf := [3]byte{frfMSB[cfg.Band], frfMID[cfg.Band], frfLSB[cfg.Band]}
+	if cfg.Frequency != 0 {
+		frf = frfBytes(cfg.Frequency)
+	}
+
 	return [][2]byte{
 		{REG_OPMODE, RF_OPMODE_SEQUENCER_ON | RF_OPMODE_LISTEN_OFF | RF_OPMODE_STANDBY}, // 0x01
 
@@ -42,15 +63,15 @@ func getConfig(
 		{REG_DATAMODUL, RF_DATAMODUL_DATAMODE_PACKET | RF_DATAMODUL_MODULATIONTYPE_FSK | RF_DATAMODUL_MODULATIONSHAPING_00},
 
 		//default:4.8 KBPS
-		{REG_BITRATEMSB, RF_BITRATEMSB_55555},
-		{REG_BITRATELSB, RF_BITRATELSB_55555},
+		{REG_BITRATEMSB, byte(bitRate >> 8)},
+		{REG_BITRATELSB, byte(bitRate)},
 
 		//default:5khz, (FDEV + BitRate/2 <= 500Khz)
 		{REG_FDEVMSB, RF_FDEVMSB_50000},
 		{REG_FDEVLSB, RF_FDEVLSB_50000},
-		{REG_FRFMSB, frfMSB[freqBand]},
-		{REG_FRFMID, frfMID[freqBand]},
-		{REG_FRFLSB, frfLSB[freqBand]},
+		{REG_FRFMSB, frf[0]},
+		{REG_FRFMID, frf[1]},
+		{REG_FRFLSB, frf[2]},
 
 		// looks like PA1 and PA2 are not implemented on RFM69W, hence the max output power is 13dBm
 		// +17dBm and +20dBm are possible on RFM69HW
@@ -79,7 +100,7 @@ func getConfig(
 		{REG_SYNCVALUE1, 0x2D},
 
 		//NETWORK ID
-		{REG_SYNCVALUE2, networkID},
+		{REG_SYNCVALUE2, cfg.NetworkID},
 
 		{REG_PACKETCONFIG1, RF_PACKET1_FORMAT_VARIABLE | RF_PACKET1_DCFREE_OFF | RF_PACKET1_CRC_ON | RF_PACKET1_CRCAUTOCLEAR_ON | RF_PACKET1_ADRSFILTERING_OFF},
 
@@ -102,3 +123,9 @@ func getConfig(
 		{255, 0},
 	}
 }
+
+// frfBytes converts a carrier frequency in Hz to RegFrf, in 61 Hz steps.
+func frfBytes(hz uint32) [3]byte {
+	frf := uint64(hz) << 19 / fxosc
+	return [3]byte{byte(frf >> 16), byte(frf >> 8), byte(frf)}
+}
@@ -0,0 +1,454 @@
+package rfm69
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+func (f Field) String() string {
+	if f.Value == "" {
+		return f.Name
+	}
+	return f.Name + "=" + f.Value
+}
+
+type fieldKind int
+
+const (
+	fieldEnum fieldKind = iota
+	fieldFlag
+	fieldNumber
+)
+
+type fieldDef struct {
+	name   string
+	kind   fieldKind
+	mask   byte
+	values map[byte]string
+}
+
+func (d fieldDef) decode(val byte) (Field, bool) {
+	masked := val & d.mask
+
+	switch d.kind {
+	case fieldFlag:
+		if masked == 0 {
+			return Field{}, false
+		}
+		return Field{Name: d.name}, true
+	case fieldNumber:
+		shift := 0
+		for d.mask>>shift&1 == 0 {
+			shift++
+		}
+		return Field{Name: d.name, Value: fmt.Sprintf("%d", masked>>shift)}, true
+	default:
+		if s, ok := d.values[masked]; ok {
+			return Field{Name: d.name, Value: s}, true
+		}
+		return Field{Name: d.name, Value: fmt.Sprintf("0x%02x", masked)}, true
+	}
+}
+
+func onOff(mask, on byte) map[byte]string {
+	off := mask &^ on
+	return map[byte]string{on: "on", off: "off"}
+}
+
+func flag(name string, mask byte) fieldDef {
+	return fieldDef{name: name, kind: fieldFlag, mask: mask}
+}
+
+func number(name string, mask byte) fieldDef {
+	return fieldDef{name: name, kind: fieldNumber, mask: mask}
+}
+
+func enum(name string, mask byte, values map[byte]string) fieldDef {
+	return fieldDef{name: name, kind: fieldEnum, mask: mask, values: values}
+}
+
+var registerNames = map[byte]string{
+	REG_FIFO:          "Fifo",
+	REG_OPMODE:        "OpMode",
+	REG_DATAMODUL:     "DataModul",
+	REG_BITRATEMSB:    "BitrateMsb",
+	REG_BITRATELSB:    "BitrateLsb",
+	REG_FDEVMSB:       "FdevMsb",
+	REG_FDEVLSB:       "FdevLsb",
+	REG_FRFMSB:        "FrfMsb",
+	REG_FRFMID:        "FrfMid",
+	REG_FRFLSB:        "FrfLsb",
+	REG_OSC1:          "Osc1",
+	REG_AFCCTRL:       "AfcCtrl",
+	REG_LOWBAT:        "LowBat",
+	REG_LISTEN1:       "Listen1",
+	REG_LISTEN2:       "Listen2",
+	REG_LISTEN3:       "Listen3",
+	REG_VERSION:       "Version",
+	REG_PALEVEL:       "PaLevel",
+	REG_PARAMP:        "PaRamp",
+	REG_OCP:           "Ocp",
+	REG_AGCREF:        "AgcRef",
+	REG_AGCTHRESH1:    "AgcThresh1",
+	REG_AGCTHRESH2:    "AgcThresh2",
+	REG_AGCTHRESH3:    "AgcThresh3",
+	REG_LNA:           "Lna",
+	REG_RXBW:          "RxBw",
+	REG_AFCBW:         "AfcBw",
+	REG_OOKPEAK:       "OokPeak",
+	REG_OOKAVG:        "OokAvg",
+	REG_OOKFIX:        "OokFix",
+	REG_AFCFEI:        "AfcFei",
+	REG_AFCMSB:        "AfcMsb",
+	REG_AFCLSB:        "AfcLsb",
+	REG_FEIMSB:        "FeiMsb",
+	REG_FEILSB:        "FeiLsb",
+	REG_RSSICONFIG:    "RssiConfig",
+	REG_RSSIVALUE:     "RssiValue",
+	REG_DIOMAPPING1:   "DioMapping1",
+	REG_DIOMAPPING2:   "DioMapping2",
+	REG_IRQFLAGS1:     "IrqFlags1",
+	REG_IRQFLAGS2:     "IrqFlags2",
+	REG_RSSITHRESH:    "RssiThresh",
+	REG_RXTIMEOUT1:    "RxTimeout1",
+	REG_RXTIMEOUT2:    "RxTimeout2",
+	REG_PREAMBLEMSB:   "PreambleMsb",
+	REG_PREAMBLELSB:   "PreambleLsb",
+	REG_SYNCCONFIG:    "SyncConfig",
+	REG_SYNCVALUE1:    "SyncValue1",
+	REG_SYNCVALUE2:    "SyncValue2",
+	REG_SYNCVALUE3:    "SyncValue3",
+	REG_SYNCVALUE4:    "SyncValue4",
+	REG_SYNCVALUE5:    "SyncValue5",
+	REG_SYNCVALUE6:    "SyncValue6",
+	REG_SYNCVALUE7:    "SyncValue7",
+	REG_SYNCVALUE8:    "SyncValue8",
+	REG_PACKETCONFIG1: "PacketConfig1",
+	REG_PAYLOADLENGTH: "PayloadLength",
+	REG_NODEADRS:      "NodeAdrs",
+	REG_BROADCASTADRS: "BroadcastAdrs",
+	REG_AUTOMODES:     "AutoModes",
+	REG_FIFOTHRESH:    "FifoThresh",
+	REG_PACKETCONFIG2: "PacketConfig2",
+	REG_AESKEY1:       "AesKey1",
+	REG_AESKEY2:       "AesKey2",
+	REG_AESKEY3:       "AesKey3",
+	REG_AESKEY4:       "AesKey4",
+	REG_AESKEY5:       "AesKey5",
+	REG_AESKEY6:       "AesKey6",
+	REG_AESKEY7:       "AesKey7",
+	REG_AESKEY8:       "AesKey8",
+	REG_AESKEY9:       "AesKey9",
+	REG_AESKEY10:      "AesKey10",
+	REG_AESKEY11:      "AesKey11",
+	REG_AESKEY12:      "AesKey12",
+	REG_AESKEY13:      "AesKey13",
+	REG_AESKEY14:      "AesKey14",
+	REG_AESKEY15:      "AesKey15",
+	REG_AESKEY16:      "AesKey16",
+	REG_TEMP1:         "Temp1",
+	REG_TEMP2:         "Temp2",
+	REG_TESTPA1:       "TestPa1",
+	REG_TESTPA2:       "TestPa2",
+	REG_TESTDAGC:      "TestDagc",
+}
+
+var registerFields = map[byte][]fieldDef{
+	REG_OPMODE: {
+		enum("Sequencer", 0x80, map[byte]string{
+			RF_OPMODE_SEQUENCER_ON:  "on",
+			RF_OPMODE_SEQUENCER_OFF: "off",
+		}),
+		enum("Listen", 0x40, onOff(0x40, RF_OPMODE_LISTEN_ON)),
+		flag("ListenAbort", RF_OPMODE_LISTENABORT),
+		enum("Mode", 0x1C, map[byte]string{
+			RF_OPMODE_SLEEP:       "Sleep",
+			RF_OPMODE_STANDBY:     "Standby",
+			RF_OPMODE_SYNTHESIZER: "Synthesizer",
+			RF_OPMODE_TRANSMITTER: "Transmitter",
+			RF_OPMODE_RECEIVER:    "Receiver",
+		}),
+	},
+	REG_DATAMODUL: {
+		enum("DataMode", 0x60, map[byte]string{
+			RF_DATAMODUL_DATAMODE_PACKET:            "Packet",
+			RF_DATAMODUL_DATAMODE_CONTINUOUS:        "Continuous",
+			RF_DATAMODUL_DATAMODE_CONTINUOUSNOBSYNC: "ContinuousNoBsync",
+		}),
+		enum("Modulation", 0x18, map[byte]string{
+			RF_DATAMODUL_MODULATIONTYPE_FSK: "FSK",
+			RF_DATAMODUL_MODULATIONTYPE_OOK: "OOK",
+		}),
+		number("Shaping", 0x03),
+	},
+	REG_PALEVEL: {
+		enum("Pa0", 0x80, onOff(0x80, RF_PALEVEL_PA0_ON)),
+		enum("Pa1", 0x40, onOff(0x40, RF_PALEVEL_PA1_ON)),
+		enum("Pa2", 0x20, onOff(0x20, RF_PALEVEL_PA2_ON)),
+		number("OutputPower", 0x1F),
+	},
+	REG_PARAMP: {
+		enum("PaRamp", 0x0F, map[byte]string{
+			RF_PARAMP_3400: "3.4ms",
+			RF_PARAMP_2000: "2ms",
+			RF_PARAMP_1000: "1ms",
+			RF_PARAMP_500:  "500us",
+			RF_PARAMP_250:  "250us",
+			RF_PARAMP_125:  "125us",
+			RF_PARAMP_100:  "100us",
+			RF_PARAMP_62:   "62us",
+			RF_PARAMP_50:   "50us",
+			RF_PARAMP_40:   "40us",
+			RF_PARAMP_31:   "31us",
+			RF_PARAMP_25:   "25us",
+			RF_PARAMP_20:   "20us",
+			RF_PARAMP_15:   "15us",
+			RF_PARAMP_12:   "12us",
+			RF_PARAMP_10:   "10us",
+		}),
+	},
+	REG_OCP: {
+		enum("Ocp", 0x10, onOff(0x10, 0x10)),
+		number("OcpTrim", 0x0F),
+	},
+	REG_LNA: {
+		enum("LnaZin", 0x80, map[byte]string{
+			RF_LNA_ZIN_50:  "50ohm",
+			RF_LNA_ZIN_200: "200ohm",
+		}),
+		number("CurrentGain", 0x38),
+		enum("GainSelect", 0x07, map[byte]string{
+			RF_LNA_GAINSELECT_AUTO:       "Auto",
+			RF_LNA_GAINSELECT_MAX:        "Max",
+			RF_LNA_GAINSELECT_MAXMINUS6:  "Max-6",
+			RF_LNA_GAINSELECT_MAXMINUS12: "Max-12",
+			RF_LNA_GAINSELECT_MAXMINUS24: "Max-24",
+			RF_LNA_GAINSELECT_MAXMINUS36: "Max-36",
+			RF_LNA_GAINSELECT_MAXMINUS48: "Max-48",
+		}),
+	},
+	REG_RXBW: {
+		number("DccFreq", 0xE0),
+		enum("Mant", 0x18, map[byte]string{
+			RF_RXBW_MANT_16: "16",
+			RF_RXBW_MANT_20: "20",
+			RF_RXBW_MANT_24: "24",
+		}),
+		number("Exp", 0x07),
+	},
+	REG_AFCBW: {
+		number("DccFreqAfc", 0xE0),
+		enum("MantAfc", 0x18, map[byte]string{
+			RF_AFCBW_MANTAFC_16: "16",
+			RF_AFCBW_MANTAFC_20: "20",
+			RF_AFCBW_MANTAFC_24: "24",
+		}),
+		number("ExpAfc", 0x07),
+	},
+	REG_AFCFEI: {
+		flag("FeiDone", RF_AFCFEI_FEI_DONE),
+		flag("FeiStart", RF_AFCFEI_FEI_START),
+		flag("AfcDone", RF_AFCFEI_AFC_DONE),
+		enum("AfcAutoClear", 0x08, onOff(0x08, RF_AFCFEI_AFCAUTOCLEAR_ON)),
+		enum("AfcAuto", 0x04, onOff(0x04, RF_AFCFEI_AFCAUTO_ON)),
+		flag("AfcClear", RF_AFCFEI_AFC_CLEAR),
+		flag("AfcStart", RF_AFCFEI_AFC_START),
+	},
+	REG_RSSICONFIG: {
+		flag("RssiDone", RF_RSSI_DONE),
+		flag("RssiStart", RF_RSSI_START),
+	},
+	REG_DIOMAPPING1: {
+		number("Dio0", 0xC0),
+		number("Dio1", 0x30),
+		number("Dio2", 0x0C),
+		number("Dio3", 0x03),
+	},
+	REG_DIOMAPPING2: {
+		number("Dio4", 0xC0),
+		number("Dio5", 0x30),
+		enum("ClkOut", 0x07, map[byte]string{
+			RF_DIOMAPPING2_CLKOUT_32:  "FXOSC",
+			RF_DIOMAPPING2_CLKOUT_16:  "FXOSC/2",
+			RF_DIOMAPPING2_CLKOUT_8:   "FXOSC/4",
+			RF_DIOMAPPING2_CLKOUT_4:   "FXOSC/8",
+			RF_DIOMAPPING2_CLKOUT_2:   "FXOSC/16",
+			RF_DIOMAPPING2_CLKOUT_1:   "FXOSC/32",
+			RF_DIOMAPPING2_CLKOUT_RC:  "RC",
+			RF_DIOMAPPING2_CLKOUT_OFF: "off",
+		}),
+	},
+	REG_IRQFLAGS1: {
+		flag("ModeReady", RF_IRQFLAGS1_MODEREADY),
+		flag("RxReady", RF_IRQFLAGS1_RXREADY),
+		flag("TxReady", RF_IRQFLAGS1_TXREADY),
+		flag("PllLock", RF_IRQFLAGS1_PLLLOCK),
+		flag("Rssi", RF_IRQFLAGS1_RSSI),
+		flag("Timeout", RF_IRQFLAGS1_TIMEOUT),
+		flag("AutoMode", RF_IRQFLAGS1_AUTOMODE),
+		flag("SyncAddressMatch", RF_IRQFLAGS1_SYNCADDRESSMATCH),
+	},
+	REG_IRQFLAGS2: {
+		flag("FifoFull", RF_IRQFLAGS2_FIFOFULL),
+		flag("FifoNotEmpty", RF_IRQFLAGS2_FIFONOTEMPTY),
+		flag("FifoLevel", RF_IRQFLAGS2_FIFOLEVEL),
+		flag("FifoOverrun", RF_IRQFLAGS2_FIFOOVERRUN),
+		flag("PacketSent", RF_IRQFLAGS2_PACKETSENT),
+		flag("PayloadReady", RF_IRQFLAGS2_PAYLOADREADY),
+		flag("CrcOk", RF_IRQFLAGS2_CRCOK),
+		flag("LowBat", RF_IRQFLAGS2_LOWBAT),
+	},
+	REG_SYNCCONFIG: {
+		enum("Sync", 0x80, onOff(0x80, RF_SYNC_ON)),
+		enum("FifoFill", 0x40, map[byte]string{
+			RF_SYNC_FIFOFILL_AUTO:   "auto",
+			RF_SYNC_FIFOFILL_MANUAL: "manual",
+		}),
+		enum("SyncSize", 0x38, map[byte]string{
+			RF_SYNC_SIZE_1: "1",
+			RF_SYNC_SIZE_2: "2",
+			RF_SYNC_SIZE_3: "3",
+			RF_SYNC_SIZE_4: "4",
+			RF_SYNC_SIZE_5: "5",
+			RF_SYNC_SIZE_6: "6",
+			RF_SYNC_SIZE_7: "7",
+			RF_SYNC_SIZE_8: "8",
+		}),
+		number("SyncTol", 0x07),
+	},
+	REG_PACKETCONFIG1: {
+		enum("Format", 0x80, map[byte]string{
+			RF_PACKET1_FORMAT_FIXED:    "fixed",
+			RF_PACKET1_FORMAT_VARIABLE: "variable",
+		}),
+		enum("DcFree", 0x60, map[byte]string{
+			RF_PACKET1_DCFREE_OFF:        "off",
+			RF_PACKET1_DCFREE_MANCHESTER: "Manchester",
+			RF_PACKET1_DCFREE_WHITENING:  "Whitening",
+		}),
+		enum("Crc", 0x10, onOff(0x10, RF_PACKET1_CRC_ON)),
+		enum("CrcAutoClear", 0x08, map[byte]string{
+			RF_PACKET1_CRCAUTOCLEAR_ON:  "on",
+			RF_PACKET1_CRCAUTOCLEAR_OFF: "off",
+		}),
+		enum("AddressFiltering", 0x06, map[byte]string{
+			RF_PACKET1_ADRSFILTERING_OFF:           "off",
+			RF_PACKET1_ADRSFILTERING_NODE:          "node",
+			RF_PACKET1_ADRSFILTERING_NODEBROADCAST: "node+broadcast",
+		}),
+	},
+	REG_AUTOMODES: {
+		enum("EnterCondition", 0xE0, map[byte]string{
+			RF_AUTOMODES_ENTER_OFF:           "off",
+			RF_AUTOMODES_ENTER_FIFONOTEMPTY:  "FifoNotEmpty",
+			RF_AUTOMODES_ENTER_FIFOLEVEL:     "FifoLevel",
+			RF_AUTOMODES_ENTER_CRCOK:         "CrcOk",
+			RF_AUTOMODES_ENTER_PAYLOADREADY:  "PayloadReady",
+			RF_AUTOMODES_ENTER_SYNCADRSMATCH: "SyncAddressMatch",
+			RF_AUTOMODES_ENTER_PACKETSENT:    "PacketSent",
+			RF_AUTOMODES_ENTER_FIFOEMPTY:     "FifoEmpty",
+		}),
+		enum("ExitCondition", 0x1C, map[byte]string{
+			RF_AUTOMODES_EXIT_OFF:           "off",
+			RF_AUTOMODES_EXIT_FIFOEMPTY:     "FifoEmpty",
+			RF_AUTOMODES_EXIT_FIFOLEVEL:     "FifoLevel",
+			RF_AUTOMODES_EXIT_CRCOK:         "CrcOk",
+			RF_AUTOMODES_EXIT_PAYLOADREADY:  "PayloadReady",
+			RF_AUTOMODES_EXIT_SYNCADRSMATCH: "SyncAddressMatch",
+			RF_AUTOMODES_EXIT_PACKETSENT:    "PacketSent",
+			RF_AUTOMODES_EXIT_RXTIMEOUT:     "RxTimeout",
+		}),
+		enum("IntermediateMode", 0x03, map[byte]string{
+			RF_AUTOMODES_INTERMEDIATE_SLEEP:       "Sleep",
+			RF_AUTOMODES_INTERMEDIATE_STANDBY:     "Standby",
+			RF_AUTOMODES_INTERMEDIATE_RECEIVER:    "Receiver",
+			RF_AUTOMODES_INTERMEDIATE_TRANSMITTER: "Transmitter",
+		}),
+	},
+	REG_FIFOTHRESH: {
+		enum("TxStart", 0x80, map[byte]string{
+			RF_FIFOTHRESH_TXSTART_FIFOTHRESH:   "FifoLevel",
+			RF_FIFOTHRESH_TXSTART_FIFONOTEMPTY: "FifoNotEmpty",
+		}),
+		number("FifoThreshold", 0x7F),
+	},
+	REG_PACKETCONFIG2: {
+		enum("InterPacketRxDelay", 0xF0, map[byte]string{
+			RF_PACKET2_RXRESTARTDELAY_1BIT:     "1bit",
+			RF_PACKET2_RXRESTARTDELAY_2BITS:    "2bits",
+			RF_PACKET2_RXRESTARTDELAY_4BITS:    "4bits",
+			RF_PACKET2_RXRESTARTDELAY_8BITS:    "8bits",
+			RF_PACKET2_RXRESTARTDELAY_16BITS:   "16bits",
+			RF_PACKET2_RXRESTARTDELAY_32BITS:   "32bits",
+			RF_PACKET2_RXRESTARTDELAY_64BITS:   "64bits",
+			RF_PACKET2_RXRESTARTDELAY_128BITS:  "128bits",
+			RF_PACKET2_RXRESTARTDELAY_256BITS:  "256bits",
+			RF_PACKET2_RXRESTARTDELAY_512BITS:  "512bits",
+			RF_PACKET2_RXRESTARTDELAY_1024BITS: "1024bits",
+			RF_PACKET2_RXRESTARTDELAY_2048BITS: "2048bits",
+			RF_PACKET2_RXRESTARTDELAY_NONE:     "none",
+		}),
+		flag("RestartRx", RF_PACKET2_RXRESTART),
+		enum("AutoRxRestart", 0x02, onOff(0x02, RF_PACKET2_AUTORXRESTART_ON)),
+		enum("Aes", 0x01, onOff(0x01, RF_PACKET2_AES_ON)),
+	},
+	REG_TEMP1: {
+		flag("TempMeasStart", RF_TEMP1_MEAS_START),
+		flag("TempMeasRunning", RF_TEMP1_MEAS_RUNNING),
+	},
+	REG_TESTDAGC: {
+		enum("ContinuousDagc", 0xFF, map[byte]string{
+			RF_DAGC_NORMAL:            "normal",
+			RF_DAGC_IMPROVED_LOWBETA1: "improved-lowbeta1",
+			RF_DAGC_IMPROVED_LOWBETA0: "improved-lowbeta0",
+		}),
+	},
+}
+
+func RegisterName(addr byte) string {
+	if name, ok := registerNames[addr]; ok {
+		return name
+	}
+	return fmt.Sprintf("Reg%02X", addr)
+}
+
+func DecodeRegister(addr byte, val byte) []Field {
+	switch addr {
+	case REG_VERSION:
+		return []Field{
+			{Name: "Revision", Value: fmt.Sprintf("%d", val>>4)},
+			{Name: "Mask", Value: fmt.Sprintf("%d", val&0x0F)},
+		}
+	case REG_RSSIVALUE:
+		return []Field{{Name: "Rssi", Value: fmt.Sprintf("%.1fdBm", -float64(val)/2)}}
+	case REG_RSSITHRESH:
+		return []Field{{Name: "RssiThreshold", Value: fmt.Sprintf("%.1fdBm", -float64(val)/2)}}
+	}
+
+	defs, ok := registerFields[addr]
+	if !ok {
+		return []Field{{Name: "Value", Value: fmt.Sprintf("0x%02x", val)}}
+	}
+
+	var fields []Field
+	for _, def := range defs {
+		if f, ok := def.decode(val); ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func FormatRegister(addr byte, val byte) string {
+	fields := DecodeRegister(addr, val)
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, " ")
+}
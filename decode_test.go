@@ -0,0 +1,27 @@
+package rfm69
+
+import "testing"
+
+func TestFormatRegister(t *testing.T) {
+	tests := []struct {
+		addr byte
+		val  byte
+		want string
+	}{
+		{REG_OPMODE, 0x04, "Sequencer=on Listen=off Mode=Standby"},
+		{REG_OPMODE, 0x90, "Sequencer=off Listen=off Mode=Receiver"},
+		{REG_IRQFLAGS2, 0x46, "FifoNotEmpty PayloadReady CrcOk"},
+		{REG_IRQFLAGS2, 0x00, ""},
+		{REG_PALEVEL, 0x7F, "Pa0=off Pa1=on Pa2=on OutputPower=31"},
+		{REG_RSSIVALUE, 0xB4, "Rssi=-90.0dBm"},
+		{REG_VERSION, 0x24, "Revision=2 Mask=4"},
+		{REG_SYNCVALUE1, 0x2D, "Value=0x2d"},
+	}
+
+	for _, tt := range tests {
+		got := FormatRegister(tt.addr, tt.val)
+		if got != tt.want {
+			t.Errorf("%s=0x%02x: got %q, want %q", RegisterName(tt.addr), tt.val, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package rfm69
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+type RegisterValue struct {
+	Addr  byte
+	Value byte
+}
+
+func (r *Radio) ReadRegister(addr byte) (byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.readReg(addr)
+}
+
+// DumpRegisters reads every named register except the FIFO.
+func (r *Radio) DumpRegisters() ([]RegisterValue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var addrs []byte
+	for addr := range registerNames {
+		if addr != REG_FIFO {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	result := make([]RegisterValue, 0, len(addrs))
+	for _, addr := range addrs {
+		val, err := r.readReg(addr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, RegisterValue{Addr: addr, Value: val})
+	}
+
+	return result, nil
+}
+
+// ReadRSSI returns the current RSSI in dBm. It is only meaningful in RX.
+func (r *Radio) ReadRSSI() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.readRSSI()
+}
+
+// ReadTemperature returns the coarse die temperature in °C. The chip is
+// left in standby.
+func (r *Radio) ReadTemperature() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.setMode(ModeStandby); err != nil {
+		return 0, errors.Wrap(err, "set standby")
+	}
+	if err := r.waitForModeReady(); err != nil {
+		return 0, errors.Wrap(err, "wait for standby")
+	}
+	if err := r.writeReg(REG_TEMP1, RF_TEMP1_MEAS_START); err != nil {
+		return 0, errors.Wrap(err, "start measurement")
+	}
+
+	deadline := time.Now().Add(r.timeouts.ModeReady)
+	for {
+		val, err := r.readReg(REG_TEMP1)
+		if err != nil {
+			return 0, err
+		}
+		if val&RF_TEMP1_MEAS_RUNNING == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			r.metrics.timeout()
+			return 0, errors.Wrap(ErrTimeout, "temperature measurement")
+		}
+		time.Sleep(r.timeouts.PollInterval)
+	}
+
+	val, err := r.readReg(REG_TEMP2)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(^val) + COURSE_TEMP_COEF, nil
+}
+
+func (r *Radio) Frequency() uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.frequency()
+}
+
+// SetFrequency retunes the carrier without a full Setup. In RX the
+// receiver is restarted so the new frequency takes effect immediately.
+func (r *Radio) SetFrequency(hz uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setFrequency(hz)
+}
+
+func (r *Radio) setFrequency(hz uint32) error {
+	frf := frfBytes(hz)
+
+	tx := []byte{REG_FRFMSB | 0x80, frf[0], frf[1], frf[2]}
+	if err := r.board.TxSPI(tx, nil); err != nil {
+		return errors.Wrap(err, "write frf")
+	}
+
+	r.regs[REG_FRFMSB] = frf[0]
+	r.regs[REG_FRFMID] = frf[1]
+	r.regs[REG_FRFLSB] = frf[2]
+
+	opMode, err := r.readReg(REG_OPMODE)
+	if err != nil {
+		return err
+	}
+	if opMode&0x1C == RF_OPMODE_RECEIVER {
+		return r.editReg(REG_PACKETCONFIG2, func(val byte) byte {
+			return val&0xFB | RF_PACKET2_RXRESTART
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package rfm69
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkg/errors"
+)
+
+// packetJSON is the canonical JSON form of a Packet. The payload is hex
+// under "payload", or base64 under "payload_base64"; readers accept
+// either.
+type packetJSON struct {
+	Src           byte    `json:"src"`
+	Dst           byte    `json:"dst"`
+	RSSI          int     `json:"rssi"`
+	Seq           *byte   `json:"seq,omitempty"`
+	Payload       *string `json:"payload,omitempty"`
+	PayloadBase64 *string `json:"payload_base64,omitempty"`
+}
+
+func (p *Packet) seq() *byte {
+	if !p.HasSeq {
+		return nil
+	}
+	seq := p.Seq
+	return &seq
+}
+
+func (p *Packet) setSeq(seq *byte) {
+	if seq != nil {
+		p.Seq, p.HasSeq = *seq, true
+	}
+}
+
+func (p Packet) MarshalJSON() ([]byte, error) {
+	payload := hex.EncodeToString(p.Payload)
+	return json.Marshal(packetJSON{Src: p.Src, Dst: p.Dst, RSSI: p.RSSI, Seq: p.seq(), Payload: &payload})
+}
+
+// MarshalJSONBase64 is MarshalJSON with the payload in base64, which is
+// more compact for large payloads.
+func (p Packet) MarshalJSONBase64() ([]byte, error) {
+	payload := base64.StdEncoding.EncodeToString(p.Payload)
+	return json.Marshal(packetJSON{Src: p.Src, Dst: p.Dst, RSSI: p.RSSI, Seq: p.seq(), PayloadBase64: &payload})
+}
+
+func (p *Packet) UnmarshalJSON(b []byte) error {
+	var j packetJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	var payload []byte
+	var err error
+	switch {
+	case j.Payload != nil && j.PayloadBase64 != nil:
+		return errors.New("both payload and payload_base64 set")
+	case j.Payload != nil:
+		payload, err = hex.DecodeString(*j.Payload)
+	case j.PayloadBase64 != nil:
+		payload, err = base64.StdEncoding.DecodeString(*j.PayloadBase64)
+	}
+	if err != nil {
+		return errors.Wrap(err, "decode payload")
+	}
+
+	*p = Packet{Src: j.Src, Dst: j.Dst, RSSI: j.RSSI, Payload: payload}
+	p.setSeq(j.Seq)
+	return nil
+}
+
+// packetCBOR is the CBOR form of a Packet: a map with small integer keys,
+// encoded deterministically.
+type packetCBOR struct {
+	Src     byte   `cbor:"1,keyasint"`
+	Dst     byte   `cbor:"2,keyasint"`
+	RSSI    int    `cbor:"3,keyasint"`
+	Payload []byte `cbor:"4,keyasint"`
+	Seq     *byte  `cbor:"5,keyasint,omitempty"`
+}
+
+var cborEnc = func() cbor.EncMode {
+	em, err := cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return em
+}()
+
+func (p Packet) MarshalCBOR() ([]byte, error) {
+	return cborEnc.Marshal(packetCBOR{Src: p.Src, Dst: p.Dst, RSSI: p.RSSI, Payload: p.Payload, Seq: p.seq()})
+}
+
+func (p *Packet) UnmarshalCBOR(b []byte) error {
+	var c packetCBOR
+	if err := cbor.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	*p = Packet{Src: c.Src, Dst: c.Dst, RSSI: c.RSSI, Payload: c.Payload}
+	p.setSeq(c.Seq)
+	return nil
+}
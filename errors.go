@@ -0,0 +1,32 @@
+package rfm69
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTimeout         = errors.New("timeout")
+	ErrNotResponding   = errors.New("radio not responding")
+	ErrPayloadTooLarge = errors.New("payload too large")
+	ErrBusy            = errors.New("radio busy")
+	ErrConfigMismatch  = errors.New("register readback differs from config")
+	ErrUnsupportedChip = errors.New("unsupported chip version")
+	ErrNotAcked        = errors.New("broadcast and group frames are not acked")
+	ErrBadAddress      = errors.New("not a node address")
+	ErrBadConfig       = errors.New("invalid config")
+)
+
+type RegisterError struct {
+	Op   string
+	Addr byte
+	Err  error
+}
+
+func (e *RegisterError) Error() string {
+	return fmt.Sprintf("%s %s (0x%02x): %v", e.Op, RegisterName(e.Addr), e.Addr, e.Err)
+}
+
+func (e *RegisterError) Unwrap() error {
+	return e.Err
+}
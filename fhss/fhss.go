@@ -0,0 +1,386 @@
+// Package fhss hops a network across a channel plan, as FCC 15.247 asks
+// of higher power transmitters in 902–928 MHz.
+//
+// Every node derives the same hop sequence from the network ID. The
+// master hops on its own clock, sending a beacon at the start of every
+// BeaconEvery-th hop:
+//
+//	0..1  rfm69.ProtoFHSS, 'H'
+//	2..3  position in the hop sequence, big endian
+//	4..7  microseconds since the hop started, stamped as it is sent
+//
+// A node without sync parks on the first channel of the sequence, where
+// the master always beacons, and follows the master from the first beacon
+// it hears. If beacons stop for SyncTimeout it parks again. On a beacon
+// hop a node only sends Guard after it has heard that hop's beacon, which
+// shows the master has retuned whatever its timers' latency and leaves it
+// time to turn back to receive; on other hops it relies on Guard.
+//
+// Transmit time is tracked per channel over a sliding 20 s window and
+// sends that would take a channel past MaxDwell are refused.
+package fhss
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxDwell is the most a channel may be occupied in any DwellWindow.
+	MaxDwell    = 400 * time.Millisecond
+	DwellWindow = 20 * time.Second
+
+	beaconLen = 8
+)
+
+var beaconMagic = []byte{rfm69.ProtoFHSS, 'H'}
+
+var (
+	ErrNotSynced     = errors.New("not synchronized to the hop sequence")
+	ErrDwellExceeded = errors.New("channel dwell limit reached")
+
+	errHopPassed = errors.New("hop over")
+)
+
+type Config struct {
+	Plan Plan
+
+	// Dwell is how long each hop lasts, at most MaxDwell.
+	Dwell time.Duration
+
+	// BeaconEvery is how many hops apart the master's beacons are.
+	BeaconEvery int
+
+	// SyncTimeout is how long a node goes without a beacon before it
+	// considers itself lost.
+	SyncTimeout time.Duration
+
+	// Guard is kept clear at each end of a hop, for timer latency and
+	// sync error; a send that would run into it waits.
+	Guard time.Duration
+
+	// Master is the only address a node takes beacons from; 0 takes them
+	// from anyone.
+	Master byte
+}
+
+var DefaultConfig = Config{
+	Plan:        US915,
+	Dwell:       300 * time.Millisecond,
+	BeaconEvery: 1,
+	SyncTimeout: 2 * time.Second,
+	Guard:       2 * time.Millisecond,
+}
+
+func (cfg Config) validate() error {
+	if err := cfg.Plan.Validate(); err != nil {
+		return err
+	}
+	if cfg.Dwell <= 0 || cfg.Dwell > MaxDwell {
+		return errors.Errorf("dwell %v must be positive and at most %v", cfg.Dwell, MaxDwell)
+	}
+	if cfg.BeaconEvery < 1 || cfg.BeaconEvery > cfg.Plan.Count {
+		return errors.Errorf("beacon every %d hops, must be 1 to %d", cfg.BeaconEvery, cfg.Plan.Count)
+	}
+	if cfg.Guard <= 0 || 4*cfg.Guard >= cfg.Dwell {
+		return errors.Errorf("guard %v must be positive and under a quarter of the dwell", cfg.Guard)
+	}
+	// one lost beacon shouldn't lose sync
+	if interval := time.Duration(cfg.BeaconEvery) * cfg.Dwell; cfg.SyncTimeout < 2*interval {
+		return errors.Errorf("sync timeout %v must cover two beacon intervals of %v", cfg.SyncTimeout, interval)
+	}
+	return nil
+}
+
+// ChannelStats is the use of one channel.
+type ChannelStats struct {
+	Frequency uint32
+
+	// Tuned is the total time spent on the channel.
+	Tuned time.Duration
+
+	// Tx is the time spent transmitting on it in the last DwellWindow.
+	Tx time.Duration
+}
+
+type txRecord struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// hopper keeps the radio on the channel the hop sequence calls for.
+type hopper struct {
+	radio *rfm69.Radio
+	clock rfm69.Clock
+	cfg   Config
+	seq   []int
+
+	// follower is set on nodes, which wait for the beacon on beacon hops
+	follower bool
+
+	mu      sync.Mutex
+	synced  bool
+	start   time.Time // when hop refHop began
+	refHop  int
+	hop     int       // the hop tuned to, or -1 when parked
+	heard   time.Time // when the last beacon was received
+	changed chan struct{}
+
+	channel int
+	since   time.Time
+	drops   uint64
+	stats   []ChannelStats
+	txs     [][]txRecord
+}
+
+func newHopper(radio *rfm69.Radio, cfg Config) (*hopper, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &hopper{
+		radio:   radio,
+		clock:   radio.Clock(),
+		cfg:     cfg,
+		seq:     Sequence(cfg.Plan, radio.Config().NetworkID),
+		hop:     -1,
+		channel: -1,
+		changed: make(chan struct{}),
+		stats:   make([]ChannelStats, cfg.Plan.Count),
+		txs:     make([][]txRecord, cfg.Plan.Count),
+	}, nil
+}
+
+// position returns the hop due at t and when it began. h.mu must be held,
+// and h.synced set.
+func (h *hopper) position(t time.Time) (int, time.Time) {
+	d := t.Sub(h.start)
+	n := int(d / h.cfg.Dwell)
+	if d%h.cfg.Dwell < 0 {
+		n--
+	}
+	began := h.start.Add(time.Duration(n) * h.cfg.Dwell)
+	hop := ((h.refHop+n)%len(h.seq) + len(h.seq)) % len(h.seq)
+	return hop, began
+}
+
+// retune moves to the channel due now, returning the hop and when the
+// next one is due. When not synced, it parks on the first channel of
+// the sequence until resync.
+func (h *hopper) retune() (int, time.Time, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.clock.Now()
+
+	hop, next := -1, time.Time{}
+	ch := h.seq[0]
+	if h.synced {
+		var began time.Time
+		hop, began = h.position(now)
+		ch, next = h.seq[hop], began.Add(h.cfg.Dwell)
+	}
+
+	if ch != h.channel {
+		if err := h.radio.SetFrequency(h.cfg.Plan.Frequency(ch)); err != nil {
+			return 0, time.Time{}, errors.Wrap(err, "retune")
+		}
+		if h.channel >= 0 {
+			h.stats[h.channel].Tuned += now.Sub(h.since)
+		}
+		h.channel, h.since = ch, now
+	}
+
+	if hop != h.hop {
+		h.hop = hop
+		h.notify()
+	}
+
+	return hop, next, nil
+}
+
+// notify wakes sends waiting for the hop or beacon state to change. h.mu
+// must be held.
+func (h *hopper) notify() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// lead is how far into hop sends may start: past the guard, and on beacon
+// hops past the beacon too.
+func (h *hopper) lead(hop int) time.Duration {
+	if hop%h.cfg.BeaconEvery != 0 {
+		return h.cfg.Guard
+	}
+	return 2*h.cfg.Guard + h.airtime(beaconLen)
+}
+
+// airtime is the airtime of a msgLen byte message, with any sequence
+// number the radio adds.
+func (h *hopper) airtime(msgLen int) time.Duration {
+	return h.radio.Airtime(msgLen + rfm69.RF69_MAX_DATA_LEN - h.radio.MaxPayload())
+}
+
+// send transmits msg on the current hop, waiting for the next one if this
+// one hasn't room left for it.
+func (h *hopper) send(msg []byte, tx func() error) error {
+	return h.sendAfter(msg, h.lead, true, func(int, time.Time) error { return tx() })
+}
+
+// sendAfter sends msg with tx once it is lead into the hop. If the hop
+// has no room left, it waits for the next one, or with wait unset, fails
+// with errHopPassed. tx is given the hop and when it began.
+func (h *hopper) sendAfter(
+	msg []byte,
+	lead func(hop int) time.Duration,
+	wait bool,
+	tx func(hop int, began time.Time) error,
+) error {
+	air := h.airtime(len(msg))
+
+	for {
+		h.mu.Lock()
+		if !h.synced {
+			h.mu.Unlock()
+			return ErrNotSynced
+		}
+
+		now := h.clock.Now()
+		hop, began := h.position(now)
+		into := now.Sub(began)
+		left := h.cfg.Dwell - into
+		beaconHop := h.follower && hop%h.cfg.BeaconEvery == 0
+		beaconDue := beaconHop && h.heard.Before(began)
+
+		delay := lead(hop) - into
+		if beaconHop && !beaconDue {
+			// the master needs time to turn back to receive
+			delay = max(delay, h.heard.Add(h.cfg.Guard).Sub(now))
+		}
+
+		switch {
+		case hop == h.hop && delay > 0:
+			h.mu.Unlock()
+			<-after(h.clock, delay)
+
+		case hop == h.hop && left >= air+h.cfg.Guard && !beaconDue:
+			// holding h.mu keeps retune from moving the radio mid-frame
+			err := h.transmit(now, air, func() error { return tx(hop, began) })
+			h.mu.Unlock()
+			return err
+
+		case !wait:
+			h.mu.Unlock()
+			return errHopPassed
+
+		default:
+			changed := h.changed
+			h.mu.Unlock()
+			<-changed
+		}
+	}
+}
+
+// transmit sends with tx, within the channel's dwell limit. h.mu must be
+// held.
+func (h *hopper) transmit(now time.Time, air time.Duration, tx func() error) error {
+	ch := h.channel
+
+	recent := h.txs[ch][:0]
+	var used time.Duration
+	for _, rec := range h.txs[ch] {
+		if now.Sub(rec.at) < DwellWindow {
+			recent = append(recent, rec)
+			used += rec.duration
+		}
+	}
+	h.txs[ch] = recent
+
+	if used+air > MaxDwell {
+		return errors.Wrapf(ErrDwellExceeded, "%d Hz", h.cfg.Plan.Frequency(ch))
+	}
+	if err := tx(); err != nil {
+		return err
+	}
+
+	h.txs[ch] = append(h.txs[ch], txRecord{now, air})
+	return nil
+}
+
+// stop parks the hopper, failing waiting sends.
+func (h *hopper) stop() {
+	h.mu.Lock()
+	h.synced = false
+	h.mu.Unlock()
+
+	_, _, _ = h.retune()
+}
+
+func (h *hopper) synchronized() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.synced
+}
+
+func (h *hopper) channelStats() []ChannelStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.clock.Now()
+	result := make([]ChannelStats, len(h.stats))
+	for ch := range h.stats {
+		result[ch] = h.stats[ch]
+		result[ch].Frequency = h.cfg.Plan.Frequency(ch)
+		if ch == h.channel {
+			result[ch].Tuned += now.Sub(h.since)
+		}
+		for _, rec := range h.txs[ch] {
+			if now.Sub(rec.at) < DwellWindow {
+				result[ch].Tx += rec.duration
+			}
+		}
+	}
+	return result
+}
+
+type timers interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+func after(c rfm69.Clock, d time.Duration) <-chan time.Time {
+	if t, ok := c.(timers); ok {
+		return t.After(d)
+	}
+	return time.After(d)
+}
+
+func parseBeacon(p *rfm69.Packet) (hop int, elapsed time.Duration, ok bool) {
+	if len(p.Payload) != beaconLen || string(p.Payload[:2]) != string(beaconMagic) {
+		return 0, 0, false
+	}
+	hop = int(binary.BigEndian.Uint16(p.Payload[2:]))
+	elapsed = time.Duration(binary.BigEndian.Uint32(p.Payload[4:])) * time.Microsecond
+	return hop, elapsed, true
+}
+
+// forward passes p on to out, dropping it if out is full rather than
+// holding up the hop timing.
+func (h *hopper) forward(out chan<- *rfm69.Packet, p *rfm69.Packet) {
+	select {
+	case out <- p:
+	default:
+		h.mu.Lock()
+		h.drops++
+		h.mu.Unlock()
+	}
+}
+
+func (h *hopper) dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.drops
+}
@@ -0,0 +1,306 @@
+package fhss
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+	"github.com/pkg/errors"
+)
+
+func TestSequence(t *testing.T) {
+	a := Sequence(US915, 100)
+	if b := Sequence(US915, 100); !equal(a, b) {
+		t.Fatal("sequence is not deterministic")
+	}
+	if b := Sequence(US915, 101); equal(a, b) {
+		t.Error("networks 100 and 101 share a sequence")
+	}
+
+	seen := map[int]bool{}
+	for _, ch := range a {
+		if ch < 0 || ch >= US915.Count || seen[ch] {
+			t.Fatalf("not a permutation: %v", a)
+		}
+		seen[ch] = true
+	}
+
+	if err := US915.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (Plan{First: 902_300_000, Spacing: 400_000, Count: 40}).Validate(); err == nil {
+		t.Error("accepted 40 channels")
+	}
+	if err := (Plan{First: 915_000_000, Spacing: 400_000, Count: 64}).Validate(); err == nil {
+		t.Error("accepted channels above 928 MHz")
+	}
+}
+
+func equal(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestDwellLimit(t *testing.T) {
+	r := rfm69.NewRadio(sim.NewMedium().NewBoard(), rfm69.WithAddress(1))
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	h, err := newHopper(r, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.channel = 3
+
+	air := r.Airtime(60)
+	now := time.Unix(1_700_000_000, 0)
+	tx := func() error { return nil }
+
+	sent := 0
+	for ; sent < 1000; sent++ {
+		if err := h.transmit(now, air, tx); err != nil {
+			if !errors.Is(err, ErrDwellExceeded) {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if want := int(MaxDwell / air); sent != want {
+		t.Errorf("sent %d frames of %v, want %d", sent, air, want)
+	}
+
+	if err := h.transmit(now.Add(DwellWindow), air, tx); err != nil {
+		t.Errorf("after the window: %v", err)
+	}
+}
+
+// advance runs the virtual clock forward by d, from one timer to the
+// next, pausing after each for whatever it woke to run. Time never passes
+// while the radios are busy, so they see each event at the time it was
+// due however slowly the test runs.
+func advance(clock *sim.VirtualClock, d time.Duration) {
+	for end := clock.Now().Add(d); clock.Now().Before(end); {
+		next, ok := clock.Next()
+		if !ok || next.After(end) {
+			next = end
+		}
+		clock.Advance(next.Sub(clock.Now()))
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestHopping(t *testing.T) {
+	// frames are on the air by the virtual clock too, so hops and frames
+	// keep in step however slowly the test runs
+	m := sim.NewMedium()
+	clock := sim.NewVirtualClock(time.Unix(1_700_000_000, 0))
+	m.SetClock(clock)
+
+	// frames take as long as the test takes to advance the clock
+	timeouts := rfm69.DefaultTimeouts
+	timeouts.PacketSentMargin = time.Second
+
+	newRadio := func(addr byte) (*rfm69.Radio, *sim.Board) {
+		b := m.NewBoard()
+		r := rfm69.NewRadio(b,
+			rfm69.WithAddress(addr),
+			rfm69.WithClock(clock),
+			rfm69.WithTimeouts(timeouts),
+		)
+		if err := r.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		return r, b
+	}
+
+	cfg := DefaultConfig
+	cfg.Plan.Count = 50
+	cfg.Dwell = 20 * time.Millisecond
+	cfg.BeaconEvery = 2
+	cfg.SyncTimeout = 4 * cfg.Dwell
+	cfg.Guard = 4 * time.Millisecond
+	cfg.Master = 1
+
+	mr, mb := newRadio(1)
+	master, err := NewMaster(mr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nr, nb := newRadio(2)
+	node, err := NewNode(nr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rx := make(chan *rfm69.Packet, 64)
+	go func() { _ = master.Run(ctx, rx) }()
+	// nothing reads the node's frames, which mustn't hold up its hopping
+	go func() { _ = node.Run(ctx, make(chan *rfm69.Packet)) }()
+
+	period := time.Duration(cfg.Plan.Count) * cfg.Dwell
+	waitFor := func(want bool) {
+		t.Helper()
+		for i := 0; i < 12 && node.Synced() != want; i++ {
+			advance(clock, period/4)
+		}
+		if node.Synced() != want {
+			t.Fatalf("synced never became %v", want)
+		}
+	}
+
+	exchange := func() {
+		t.Helper()
+		channels := map[uint32]bool{}
+		for i := 0; i < 10; i++ {
+			sent := make(chan error, 1)
+			go func(i int) { sent <- node.SendFrame(1, []byte{byte(i)}) }(i)
+
+			var (
+				p    *rfm69.Packet
+				done bool
+			)
+			for j := 0; j < 20 && (p == nil || !done); j++ {
+				select {
+				case p = <-rx:
+				case err := <-sent:
+					if err != nil {
+						t.Fatal(err)
+					}
+					channels[nr.Frequency()] = true
+					done = true
+				default:
+					advance(clock, cfg.Dwell/4)
+				}
+			}
+			if !done || p == nil {
+				t.Fatalf("frame %d: sent %v, received %v", i, done, p != nil)
+			}
+			if p.Payload[0] != byte(i) {
+				t.Fatalf("got frame %d, want %d", p.Payload[0], i)
+			}
+			advance(clock, cfg.Dwell)
+		}
+		if len(channels) < 5 {
+			t.Errorf("frames went out on only %d channels", len(channels))
+		}
+	}
+
+	waitFor(true)
+	exchange()
+
+	m.SetLink(mb, nb, false)
+	waitFor(false)
+	if err := node.SendFrame(1, []byte{0}); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("send without sync: %v", err)
+	}
+
+	m.SetLink(mb, nb, true)
+	waitFor(true)
+	exchange()
+
+	sent := make(chan error, 1)
+	go func() { sent <- master.SendFrame(2, []byte("unread")) }()
+	for i := 0; i < 20 && len(sent) == 0; i++ {
+		advance(clock, cfg.Dwell/4)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if n := node.Dropped(); n != 1 {
+		t.Fatalf("node dropped %d frames", n)
+	}
+	exchange()
+
+	var tuned time.Duration
+	for _, ch := range master.Channels() {
+		tuned += ch.Tuned
+		if ch.Tx > MaxDwell {
+			t.Errorf("%d Hz: %v on air", ch.Frequency, ch.Tx)
+		}
+	}
+	if tuned == 0 {
+		t.Error("no time tuned recorded")
+	}
+}
+
+func TestPosition(t *testing.T) {
+	cfg := DefaultConfig
+	start := time.Unix(1_700_000_000, 0)
+	h := &hopper{cfg: cfg, seq: make([]int, 10), start: start, refHop: 5}
+
+	for _, tc := range []struct {
+		at    time.Duration
+		hop   int
+		began time.Duration
+	}{
+		{0, 5, 0},
+		{cfg.Dwell - 1, 5, 0},
+		{cfg.Dwell, 6, cfg.Dwell},
+		{-1, 4, -cfg.Dwell},
+		{-cfg.Dwell, 4, -cfg.Dwell},
+		{-2 * cfg.Dwell, 3, -2 * cfg.Dwell},
+		{-6 * cfg.Dwell, 9, -6 * cfg.Dwell},
+	} {
+		hop, began := h.position(start.Add(tc.at))
+		if hop != tc.hop || !began.Equal(start.Add(tc.began)) {
+			t.Errorf("at %v: hop %d began %v, want %d at %v",
+				tc.at, hop, began.Sub(start), tc.hop, tc.began)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for name, change := range map[string]func(*Config){
+		"zero guard":        func(c *Config) { c.Guard = 0 },
+		"guard too long":    func(c *Config) { c.Guard = c.Dwell / 4 },
+		"zero sync timeout": func(c *Config) { c.SyncTimeout = 0 },
+		"sync timeout short": func(c *Config) {
+			c.BeaconEvery = 4
+			c.SyncTimeout = time.Duration(c.BeaconEvery) * c.Dwell
+		},
+	} {
+		cfg := DefaultConfig
+		change(&cfg)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: accepted %+v", name, cfg)
+		}
+	}
+	if err := DefaultConfig.validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLateBeaconSkipped(t *testing.T) {
+	clock := sim.NewVirtualClock(time.Unix(1_700_000_000, 0))
+	r := rfm69.NewRadio(sim.NewMedium().NewBoard(), rfm69.WithAddress(1), rfm69.WithClock(clock))
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMaster(r, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tuned to hop 0, but the timer fired late enough that hop 1 is due
+	m.synced, m.start, m.hop = true, clock.Now().Add(-DefaultConfig.Dwell), 0
+
+	done := make(chan error, 1)
+	go func() { done <- m.beacon() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errHopPassed) {
+			t.Errorf("late beacon: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("late beacon waited for a retune")
+	}
+}
@@ -0,0 +1,100 @@
+package fhss
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+// Master sets the network's hop timing and beacons it.
+type Master struct {
+	*hopper
+}
+
+func NewMaster(radio *rfm69.Radio, cfg Config) (*Master, error) {
+	h, err := newHopper(radio, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Master{h}, nil
+}
+
+// SendFrame sends msg on the current channel once Run has started.
+func (m *Master) SendFrame(dst byte, msg []byte) error {
+	guard := func(int) time.Duration { return m.cfg.Guard }
+
+	return m.sendAfter(msg, guard, true, func(int, time.Time) error {
+		return m.radio.SendFrame(dst, msg)
+	})
+}
+
+// Channels returns the use of each channel.
+func (m *Master) Channels() []ChannelStats {
+	return m.channelStats()
+}
+
+// Dropped returns how many frames were dropped because Run's out was
+// full.
+func (m *Master) Dropped() uint64 {
+	return m.dropped()
+}
+
+// Run hops and beacons until ctx is done. Frames other than beacons are
+// sent to out, or dropped if it is full.
+func (m *Master) Run(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.radio.RxContext(ctx, in) }()
+
+	m.mu.Lock()
+	m.synced, m.start, m.refHop = true, m.clock.Now(), 0
+	m.mu.Unlock()
+	defer m.stop()
+
+	tick := after(m.clock, 0)
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			hop, next, err := m.retune()
+			if err != nil {
+				return err
+			}
+			if hop%m.cfg.BeaconEvery == 0 {
+				err := m.beacon()
+				// if the hop went by meanwhile, so be it; waiting for the
+				// next one would wait on this loop
+				if err != nil && !errors.Is(err, errHopPassed) {
+					return errors.Wrap(err, "send beacon")
+				}
+			}
+			tick = after(m.clock, next.Sub(m.clock.Now()))
+		case p := <-in:
+			if _, _, ok := parseBeacon(p); ok {
+				continue
+			}
+			m.forward(out, p)
+		}
+	}
+}
+
+func (m *Master) beacon() error {
+	msg := make([]byte, beaconLen)
+	copy(msg, beaconMagic)
+
+	guard := func(int) time.Duration { return m.cfg.Guard }
+
+	return m.sendAfter(msg, guard, false, func(hop int, began time.Time) error {
+		return m.radio.SendTimestamped(rfm69.RF69_BROADCAST_ADDR, msg, func(msg []byte, now time.Time) {
+			binary.BigEndian.PutUint16(msg[2:], uint16(hop))
+			binary.BigEndian.PutUint32(msg[4:], uint32(now.Sub(began)/time.Microsecond))
+		})
+	})
+}
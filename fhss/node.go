@@ -0,0 +1,126 @@
+package fhss
+
+import (
+	"context"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+)
+
+// Node follows a master's hopping.
+type Node struct {
+	*hopper
+}
+
+func NewNode(radio *rfm69.Radio, cfg Config) (*Node, error) {
+	h, err := newHopper(radio, cfg)
+	if err != nil {
+		return nil, err
+	}
+	h.follower = true
+	return &Node{h}, nil
+}
+
+// Synced reports whether the node is following the master.
+func (n *Node) Synced() bool {
+	return n.synchronized()
+}
+
+// SendFrame sends msg on the current channel, or fails with ErrNotSynced
+// if the node isn't following the master.
+func (n *Node) SendFrame(dst byte, msg []byte) error {
+	return n.send(msg, func() error {
+		return n.radio.SendFrame(dst, msg)
+	})
+}
+
+// Channels returns the use of each channel.
+func (n *Node) Channels() []ChannelStats {
+	return n.channelStats()
+}
+
+// Dropped returns how many frames were dropped because Run's out was
+// full.
+func (n *Node) Dropped() uint64 {
+	return n.dropped()
+}
+
+// Run tracks the master's beacons, hopping with it, until ctx is done.
+// Frames other than beacons are sent to out, or dropped if it is full.
+func (n *Node) Run(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- n.radio.RxContext(ctx, in) }()
+
+	defer n.stop()
+	if _, _, err := n.retune(); err != nil {
+		return err
+	}
+
+	var (
+		tick       <-chan time.Time
+		lastBeacon time.Time
+	)
+
+	hop := func() error {
+		_, next, err := n.retune()
+		if err != nil {
+			return err
+		}
+		tick = nil
+		if !next.IsZero() {
+			tick = after(n.clock, next.Sub(n.clock.Now()))
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-tick:
+			if n.clock.Now().Sub(lastBeacon) > n.cfg.SyncTimeout {
+				n.mu.Lock()
+				n.synced = false
+				n.mu.Unlock()
+			}
+			if err := hop(); err != nil {
+				return err
+			}
+
+		case p := <-in:
+			current, elapsed, ok := parseBeacon(p)
+			if !ok {
+				n.forward(out, p)
+				continue
+			}
+			if n.cfg.Master != 0 && p.Src != n.cfg.Master {
+				continue
+			}
+			if current >= len(n.seq) {
+				continue
+			}
+
+			frameLen := len(p.Payload)
+			if p.HasSeq {
+				frameLen++
+			}
+			start := p.RxTime.Add(-n.radio.Airtime(frameLen) - elapsed)
+
+			n.mu.Lock()
+			n.synced, n.start, n.refHop = true, start, current
+			n.heard = p.RxTime
+			n.notify()
+			n.mu.Unlock()
+			lastBeacon = p.RxTime
+
+			if err := hop(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package fhss
+
+import "github.com/pkg/errors"
+
+// Plan is a list of evenly spaced channels.
+type Plan struct {
+	First   uint32 // Hz
+	Spacing uint32 // Hz
+	Count   int
+}
+
+// US915 is 64 channels 400 kHz apart across 902–928 MHz.
+var US915 = Plan{First: 902_300_000, Spacing: 400_000, Count: 64}
+
+// FCC 15.247 limits for narrowband hopping in 902–928 MHz.
+const (
+	minChannels915 = 50
+	bandLow915     = 902_000_000
+	bandHigh915    = 928_000_000
+)
+
+func (p Plan) Frequency(ch int) uint32 {
+	return p.First + uint32(ch)*p.Spacing
+}
+
+// Validate checks p has enough channels, and, in the 915 MHz band, that
+// they all fall inside it.
+func (p Plan) Validate() error {
+	if p.Count < minChannels915 {
+		return errors.Errorf("%d channels, need at least %d", p.Count, minChannels915)
+	}
+	last := p.Frequency(p.Count - 1)
+	if p.First >= bandLow915 && p.First <= bandHigh915 && last > bandHigh915 {
+		return errors.Errorf("last channel %d Hz is above the band", last)
+	}
+	return nil
+}
+
+// Sequence is the order channels are visited in: a shuffle of them all,
+// seeded by the network ID, so every node of a network agrees on it. It
+// uses xorshift32 so firmware can produce the same sequence.
+func Sequence(p Plan, networkID byte) []int {
+	seq := make([]int, p.Count)
+	for i := range seq {
+		seq[i] = i
+	}
+
+	state := uint32(networkID)*0x9E3779B9 | 1
+	next := func() uint32 {
+		state ^= state << 13
+		state ^= state >> 17
+		state ^= state << 5
+		return state
+	}
+
+	for i := len(seq) - 1; i > 0; i-- {
+		j := int(next() % uint32(i+1))
+		seq[i], seq[j] = seq[j], seq[i]
+	}
+	return seq
+}
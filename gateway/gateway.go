@@ -0,0 +1,261 @@
+// Package gateway bridges a radio and an MQTT broker: received packets
+// are published, and messages on the tx topics are sent over the air.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+type Encoding int
+
+const (
+	EncodingMsgp Encoding = iota // rfm69.Packet as msgp
+	EncodingJSON                 // rfm69.Packet as JSON
+	EncodingRaw                  // the payload bytes alone
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingMsgp:
+		return "msgp"
+	case EncodingJSON:
+		return "json"
+	case EncodingRaw:
+		return "raw"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+func ParseEncoding(s string) (Encoding, error) {
+	for _, e := range []Encoding{EncodingMsgp, EncodingJSON, EncodingRaw} {
+		if e.String() == s {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown encoding %q", s)
+}
+
+// Topic templates may contain {network}, {src} and {dst}.
+type Config struct {
+	Broker   string // e.g. tcp://localhost:1883
+	ClientID string
+	Username string
+	Password string
+
+	Network byte
+
+	// RxTopic is where received packets are published.
+	RxTopic string
+
+	// TxTopic is subscribed to, with {src} and {dst} as wildcards. A
+	// {dst} segment gives the destination; otherwise it is taken from
+	// the message, which then cannot be raw.
+	TxTopic string
+
+	Encoding Encoding
+	QoS      byte
+
+	// MaxReconnectInterval caps the backoff between reconnect attempts.
+	MaxReconnectInterval time.Duration
+
+	Log *slog.Logger
+}
+
+var DefaultConfig = Config{
+	Broker:               "tcp://localhost:1883",
+	ClientID:             "rfm69-gateway",
+	Network:              rfm69.DefaultConfig.NetworkID,
+	RxTopic:              "rfm69/{network}/{src}/rx",
+	TxTopic:              "rfm69/{network}/{dst}/tx",
+	Encoding:             EncodingMsgp,
+	QoS:                  1,
+	MaxReconnectInterval: time.Minute,
+}
+
+// Sender is satisfied by *rfm69.Radio and *rfm69.Supervisor.
+type Sender interface {
+	SendFrame(toAddr byte, msg []byte) error
+}
+
+type Gateway struct {
+	cfg    Config
+	radio  Sender
+	log    *slog.Logger
+	client mqtt.Client
+}
+
+func New(cfg Config, radio Sender) *Gateway {
+	log := cfg.Log
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	return &Gateway{
+		cfg:   cfg,
+		radio: radio,
+		log:   log,
+	}
+}
+
+// Run connects to the broker and publishes packets from in until ctx is
+// done or in is closed. Lost connections are re-established, and the tx subscription
+// renewed, in the background.
+func (g *Gateway) Run(ctx context.Context, in <-chan *rfm69.Packet) error {
+	opts := mqtt.NewClientOptions().
+		AddBroker(g.cfg.Broker).
+		SetClientID(g.cfg.ClientID).
+		SetUsername(g.cfg.Username).
+		SetPassword(g.cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(g.cfg.MaxReconnectInterval).
+		SetOnConnectHandler(g.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			g.log.Warn("mqtt connection lost", "err", err)
+		})
+
+	g.client = mqtt.NewClient(opts)
+	g.client.Connect() // retries in the background
+	defer g.client.Disconnect(250)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if err := g.publish(p); err != nil {
+				g.log.Warn("publish failed", "src", p.Src, "err", err)
+			}
+		}
+	}
+}
+
+func (g *Gateway) publish(p *rfm69.Packet) error {
+	body, err := g.encode(p)
+	if err != nil {
+		return err
+	}
+
+	topic := g.topic(g.cfg.RxTopic, p.Src, p.Dst)
+	tok := g.client.Publish(topic, g.cfg.QoS, false, body)
+	if g.cfg.QoS == 0 {
+		return nil
+	}
+
+	// don't hold up later packets for long; the client keeps retrying
+	// QoS 1 and 2 messages across reconnects
+	if !tok.WaitTimeout(time.Second) {
+		return nil
+	}
+	return tok.Error()
+}
+
+func (g *Gateway) encode(p *rfm69.Packet) ([]byte, error) {
+	switch g.cfg.Encoding {
+	case EncodingMsgp:
+		return p.MarshalMsg(nil)
+	case EncodingJSON:
+		return json.Marshal(p)
+	case EncodingRaw:
+		return p.Payload, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %d", g.cfg.Encoding)
+	}
+}
+
+func (g *Gateway) topic(tmpl string, src, dst byte) string {
+	return strings.NewReplacer(
+		"{network}", strconv.Itoa(int(g.cfg.Network)),
+		"{src}", strconv.Itoa(int(src)),
+		"{dst}", strconv.Itoa(int(dst)),
+	).Replace(tmpl)
+}
+
+func (g *Gateway) subscribe(c mqtt.Client) {
+	g.log.Info("mqtt connected", "broker", g.cfg.Broker)
+
+	filter := strings.NewReplacer(
+		"{network}", strconv.Itoa(int(g.cfg.Network)),
+		"{src}", "+",
+		"{dst}", "+",
+	).Replace(g.cfg.TxTopic)
+
+	tok := c.Subscribe(filter, g.cfg.QoS, func(_ mqtt.Client, msg mqtt.Message) {
+		if err := g.handleTx(msg.Topic(), msg.Payload()); err != nil {
+			g.log.Warn("tx failed", "topic", msg.Topic(), "err", err)
+		}
+	})
+	go func() {
+		if tok.Wait(); tok.Error() != nil {
+			g.log.Error("subscribe failed", "filter", filter, "err", tok.Error())
+		}
+	}()
+}
+
+func (g *Gateway) handleTx(topic string, body []byte) error {
+	dst, hasDst, err := topicDst(g.cfg.TxTopic, topic)
+	if err != nil {
+		return err
+	}
+
+	var p rfm69.Packet
+	switch g.cfg.Encoding {
+	case EncodingMsgp:
+		if _, err := p.UnmarshalMsg(body); err != nil {
+			return errors.Wrap(err, "decode msgp")
+		}
+	case EncodingJSON:
+		if err := json.Unmarshal(body, &p); err != nil {
+			return errors.Wrap(err, "decode json")
+		}
+	case EncodingRaw:
+		if !hasDst {
+			return errors.New("raw messages need {dst} in the tx topic")
+		}
+		p.Payload = body
+	}
+
+	if hasDst {
+		p.Dst = dst
+	}
+
+	g.log.Debug("tx", "dst", p.Dst, "len", len(p.Payload))
+	return g.radio.SendFrame(p.Dst, p.Payload)
+}
+
+// topicDst extracts the {dst} segment of topic, if tmpl has one.
+func topicDst(tmpl, topic string) (byte, bool, error) {
+	want := strings.Split(tmpl, "/")
+	got := strings.Split(topic, "/")
+
+	for i, seg := range want {
+		if seg != "{dst}" {
+			continue
+		}
+		if i >= len(got) {
+			return 0, false, fmt.Errorf("topic %q has no destination", topic)
+		}
+		dst, err := strconv.ParseUint(got[i], 10, 8)
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "destination in topic %q", topic)
+		}
+		return byte(dst), true, nil
+	}
+
+	return 0, false, nil
+}
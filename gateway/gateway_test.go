@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+func startBroker(t *testing.T, addr string) *mochi.Server {
+	t.Helper()
+
+	server := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP("t1", addr, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// connect returns a client that keeps a subscription to filter, which
+// it renews after reconnecting.
+func connect(t *testing.T, addr, filter string, handler mqtt.MessageHandler) mqtt.Client {
+	t.Helper()
+
+	c := mqtt.NewClient(mqtt.NewClientOptions().
+		AddBroker("tcp://" + addr).
+		SetClientID("test").
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(100 * time.Millisecond).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			c.Subscribe(filter, 1, handler)
+		}))
+	if tok := c.Connect(); !tok.WaitTimeout(5*time.Second) || tok.Error() != nil {
+		t.Fatalf("connect: %v", tok.Error())
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+	return c
+}
+
+func newRadio(t *testing.T, m *sim.Medium, addr byte) *rfm69.Radio {
+	t.Helper()
+
+	r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(addr))
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestGateway(t *testing.T) {
+	addr := freeAddr(t)
+	broker := startBroker(t, addr)
+
+	m := sim.NewMedium()
+	gwRadio := newRadio(t, m, 1)
+	node := newRadio(t, m, 7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gwRx := make(chan *rfm69.Packet, 8)
+	nodeRx := make(chan *rfm69.Packet, 8)
+	go func() { _ = gwRadio.RxContext(ctx, gwRx) }()
+	go func() { _ = node.RxContext(ctx, nodeRx) }()
+
+	cfg := DefaultConfig
+	cfg.Broker = "tcp://" + addr
+	cfg.MaxReconnectInterval = 100 * time.Millisecond
+	go func() { _ = New(cfg, gwRadio).Run(ctx, gwRx) }()
+
+	published := make(chan mqtt.Message, 8)
+	client := connect(t, addr, "rfm69/100/+/rx", func(_ mqtt.Client, msg mqtt.Message) {
+		published <- msg
+	})
+
+	expectPublish := func(want string) {
+		t.Helper()
+
+		deadline := time.After(5 * time.Second)
+		for {
+			if err := node.SendFrame(1, []byte(want)); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case msg := <-published:
+				if msg.Topic() != "rfm69/100/7/rx" {
+					t.Errorf("topic = %q", msg.Topic())
+				}
+				var p rfm69.Packet
+				if _, err := p.UnmarshalMsg(msg.Payload()); err != nil {
+					t.Fatal(err)
+				}
+				if p.Src != 7 || string(p.Payload) != want {
+					t.Errorf("published %+v", p)
+				}
+				return
+			case <-time.After(200 * time.Millisecond):
+				// the gateway may still be (re)connecting
+			case <-deadline:
+				t.Fatalf("%q was not published", want)
+			}
+		}
+	}
+
+	expectPublish("up")
+
+	// outbound: the destination comes from the topic
+	body, _ := (&rfm69.Packet{Payload: []byte("down")}).MarshalMsg(nil)
+	deadline := time.After(5 * time.Second)
+send:
+	for {
+		client.Publish("rfm69/100/7/tx", 1, false, body)
+
+		select {
+		case p := <-nodeRx:
+			if p.Src != 1 || string(p.Payload) != "down" {
+				t.Errorf("node got %+v", p)
+			}
+			break send
+		case <-time.After(200 * time.Millisecond):
+			// the gateway's subscription may not be in place yet
+		case <-deadline:
+			t.Fatal("node received nothing")
+		}
+	}
+
+	// the gateway reconnects after the broker restarts
+	_ = broker.Close()
+	broker = startBroker(t, addr)
+	defer broker.Close()
+
+	expectPublish("after restart")
+}
+
+func TestTopicDst(t *testing.T) {
+	dst, ok, err := topicDst("rfm69/{network}/{dst}/tx", "rfm69/100/42/tx")
+	if err != nil || !ok || dst != 42 {
+		t.Errorf("got %d, %v, %v", dst, ok, err)
+	}
+
+	if _, ok, _ := topicDst("rfm69/{network}/tx", "rfm69/100/tx"); ok {
+		t.Error("found a destination in a template without one")
+	}
+
+	if _, _, err := topicDst("rfm69/{network}/{dst}/tx", "rfm69/100/999/tx"); err == nil {
+		t.Error("accepted an out of range destination")
+	}
+}
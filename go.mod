@@ -3,8 +3,21 @@ module github.com/minor-industries/rfm69
 go 1.21
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/mochi-mqtt/server/v2 v2.4.6
 	github.com/pkg/errors v0.9.1
 	github.com/tinylib/msgp v1.1.9
+	golang.org/x/sys v0.13.0
+	google.golang.org/protobuf v1.33.0
 )
 
-require github.com/philhofer/fwd v1.1.2 // indirect
+require (
+	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/philhofer/fwd v1.1.2 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
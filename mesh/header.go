@@ -0,0 +1,59 @@
+package mesh
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// Every mesh frame starts with a routing header:
+//
+//	0  message type
+//	1  final destination
+//	2  origin
+//	3  hops so far
+//	4..5  sequence number, per origin, big endian
+//
+// Sequence numbers are 16 bits so an origin can't wrap them within the
+// time duplicates are remembered, and start at random so a rebooted
+// origin's frames aren't taken for ones it sent before.
+const headerLen = 6
+
+type msgType byte
+
+const (
+	msgData msgType = iota
+	msgRouteRequest
+	msgRouteReply
+	msgRouteFailure // payload is the unreachable destination
+)
+
+type header struct {
+	typ    msgType
+	dst    byte
+	origin byte
+	hops   byte
+	seq    uint16
+}
+
+func (h header) append(b []byte) []byte {
+	b = append(b, byte(h.typ), h.dst, h.origin, h.hops)
+	return binary.BigEndian.AppendUint16(b, h.seq)
+}
+
+func parseHeader(b []byte) (header, []byte, error) {
+	if len(b) < headerLen {
+		return header{}, nil, errors.New("short mesh header")
+	}
+	h := header{
+		typ:    msgType(b[0]),
+		dst:    b[1],
+		origin: b[2],
+		hops:   b[3],
+		seq:    binary.BigEndian.Uint16(b[4:]),
+	}
+	if h.typ > msgRouteFailure {
+		return header{}, nil, errors.Errorf("unknown mesh message type %d", h.typ)
+	}
+	return h, b[headerLen:], nil
+}
@@ -0,0 +1,308 @@
+// Package mesh routes messages across several hops, in the spirit of
+// RadioHead's RHMesh. Routes are found by flooding a request through the
+// network; the destination answers along the reverse path. Each hop is
+// acknowledged, and a broken hop is repaired by finding a new route.
+package mesh
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+var ErrNoRoute = errors.New("no route")
+
+type Config struct {
+	// RouteTTL is how long an unused route is kept.
+	RouteTTL time.Duration
+
+	// DiscoveryTimeout bounds each round of route discovery, of which
+	// there are DiscoveryAttempts.
+	DiscoveryTimeout  time.Duration
+	DiscoveryAttempts int
+
+	// MaxHops limits how far route requests are flooded.
+	MaxHops byte
+
+	// Retries and AckTimeout apply to each hop.
+	Retries    int
+	AckTimeout time.Duration
+
+	// FloodJitter is the most a route request is delayed before being
+	// passed on, so that neighbours don't all transmit at once.
+	FloodJitter time.Duration
+}
+
+var DefaultConfig = Config{
+	RouteTTL:          5 * time.Minute,
+	DiscoveryTimeout:  time.Second,
+	DiscoveryAttempts: 3,
+	MaxHops:           8,
+	Retries:           3,
+	AckTimeout:        100 * time.Millisecond,
+	FloodJitter:       20 * time.Millisecond,
+}
+
+type Mesh struct {
+	radio *rfm69.Radio
+	addr  byte
+	cfg   Config
+
+	routes *routes
+	seen   *seenCache
+
+	mu  sync.Mutex
+	seq uint16
+}
+
+func New(radio *rfm69.Radio, cfg Config) *Mesh {
+	return &Mesh{
+		radio:  radio,
+		addr:   radio.Address(),
+		cfg:    cfg,
+		routes: newRoutes(cfg.RouteTTL),
+		seen:   newSeenCache(time.Minute),
+		seq:    uint16(rand.Uint32()),
+	}
+}
+
+// Routes returns a snapshot of the routing table.
+func (m *Mesh) Routes() []Route {
+	return m.routes.all()
+}
+
+func (m *Mesh) Route(dst byte) (Route, bool) {
+	return m.routes.get(dst)
+}
+
+// RxContext runs the radio's receiver, relaying and answering mesh
+// traffic, and sends messages addressed to this node to out. Their Src is
+// the origin and Dst the final destination. It must be running for
+// SendFrame to work.
+func (m *Mesh) RxContext(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.radio.RxContext(ctx, in) }()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case p := <-in:
+			if p.Dst != m.addr && p.Dst != rfm69.RF69_BROADCAST_ADDR {
+				continue
+			}
+			if msg := m.handle(ctx, p); msg != nil {
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// SendFrame sends msg to dst, finding a route first if needed. A nil
+// error means the first hop acknowledged it.
+func (m *Mesh) SendFrame(dst byte, msg []byte) error {
+	if len(msg) > m.MaxPayload() {
+		return errors.Wrapf(rfm69.ErrPayloadTooLarge, "%d bytes", len(msg))
+	}
+
+	h := header{typ: msgData, dst: dst, origin: m.addr, seq: m.nextSeq()}
+	return m.route(h, msg)
+}
+
+// MaxPayload is the largest message SendFrame accepts.
+func (m *Mesh) MaxPayload() int {
+	return m.radio.MaxPayload() - headerLen
+}
+
+func (m *Mesh) nextSeq() uint16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	return m.seq
+}
+
+// route sends a frame towards h.dst. If the next hop doesn't ack, the
+// route is dropped and one new route is looked for.
+func (m *Mesh) route(h header, body []byte) error {
+	frame := h.append(nil)
+	frame = append(frame, body...)
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		route, ok := m.routes.get(h.dst)
+		if !ok {
+			if route, err = m.discover(h.dst); err != nil {
+				return err
+			}
+		}
+
+		err = m.radio.SendWithRetry(route.Next, frame, m.cfg.Retries, m.cfg.AckTimeout)
+		if err == nil {
+			m.routes.refresh(h.dst)
+			return nil
+		}
+		if !errors.Is(err, rfm69.ErrTimeout) {
+			return err
+		}
+
+		m.routes.forgetNext(route.Next)
+	}
+
+	return errors.Wrapf(err, "route to %d", h.dst)
+}
+
+func (m *Mesh) discover(dst byte) (Route, error) {
+	for attempt := 0; attempt < m.cfg.DiscoveryAttempts; attempt++ {
+		found := m.routes.wait(dst)
+
+		h := header{typ: msgRouteRequest, dst: dst, origin: m.addr, seq: m.nextSeq()}
+		m.seen.add(h)
+		if err := m.radio.SendFrame(rfm69.RF69_BROADCAST_ADDR, h.append(nil)); err != nil {
+			return Route{}, errors.Wrap(err, "send route request")
+		}
+
+		select {
+		case <-found:
+			if route, ok := m.routes.get(dst); ok {
+				return route, nil
+			}
+		case <-time.After(m.cfg.DiscoveryTimeout):
+		}
+	}
+
+	return Route{}, errors.Wrapf(ErrNoRoute, "to %d", dst)
+}
+
+// handle processes a frame heard from a neighbour, returning it if it is
+// a message for this node.
+func (m *Mesh) handle(ctx context.Context, p *rfm69.Packet) *rfm69.Packet {
+	h, body, err := parseHeader(p.Payload)
+	if err != nil {
+		return nil
+	}
+	if h.origin == m.addr {
+		return nil // our own request, flooded back
+	}
+
+	// whoever sent this is a neighbour, and knows the way to the origin
+	m.routes.learn(p.Src, p.Src, 1)
+	m.routes.learn(h.origin, p.Src, h.hops+1)
+
+	switch h.typ {
+	case msgRouteRequest:
+		if !m.seen.add(h) {
+			return nil
+		}
+		if h.dst == m.addr {
+			reply := header{typ: msgRouteReply, dst: h.origin, origin: m.addr, seq: m.nextSeq()}
+			go m.relay(reply, nil)
+			return nil
+		}
+		if h.hops+1 < m.cfg.MaxHops {
+			h.hops++
+			go m.flood(ctx, h)
+		}
+		return nil
+
+	case msgRouteReply:
+		if h.dst != m.addr {
+			h.hops++
+			go m.relay(h, body)
+		}
+		return nil
+
+	case msgRouteFailure:
+		if len(body) > 0 {
+			m.routes.forget(body[0])
+		}
+		if h.dst != m.addr {
+			h.hops++
+			go m.relay(h, body)
+		}
+		return nil
+
+	default: // msgData
+		if !m.seen.add(h) {
+			return nil // a retransmission whose ack was lost
+		}
+		if h.dst == m.addr {
+			return &rfm69.Packet{Src: h.origin, Dst: h.dst, RSSI: p.RSSI, Payload: body}
+		}
+		h.hops++
+		go m.relay(h, body)
+		return nil
+	}
+}
+
+func (m *Mesh) flood(ctx context.Context, h header) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(rand.Int63n(int64(m.cfg.FloodJitter) + 1))):
+	}
+	_ = m.radio.SendFrame(rfm69.RF69_BROADCAST_ADDR, h.append(nil))
+}
+
+// relay passes a frame on towards its destination. If that fails, the
+// origin is told so it can drop its route.
+func (m *Mesh) relay(h header, body []byte) {
+	if h.hops >= m.cfg.MaxHops {
+		return
+	}
+	err := m.route(h, body)
+	if err == nil || h.typ == msgRouteFailure || h.origin == m.addr {
+		return
+	}
+
+	failure := header{typ: msgRouteFailure, dst: h.origin, origin: m.addr, seq: m.nextSeq()}
+	_ = m.route(failure, []byte{h.dst})
+}
+
+// seenCache remembers recent (type, origin, seq) triples so flooded and
+// retransmitted frames are handled once.
+type seenCache struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[seenKey]time.Time
+}
+
+type seenKey struct {
+	typ    msgType
+	origin byte
+	seq    uint16
+}
+
+func newSeenCache(ttl time.Duration) *seenCache {
+	return &seenCache{ttl: ttl, seen: map[seenKey]time.Time{}}
+}
+
+// add records h, returning false if it was already seen.
+func (c *seenCache) add(h header) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range c.seen {
+		if now.Sub(t) > c.ttl {
+			delete(c.seen, k)
+		}
+	}
+
+	k := seenKey{h.typ, h.origin, h.seq}
+	if _, ok := c.seen[k]; ok {
+		return false
+	}
+	c.seen[k] = now
+	return true
+}
@@ -0,0 +1,198 @@
+package mesh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+)
+
+var testConfig = Config{
+	RouteTTL:          time.Minute,
+	DiscoveryTimeout:  200 * time.Millisecond,
+	DiscoveryAttempts: 3,
+	MaxHops:           8,
+	Retries:           2,
+	AckTimeout:        50 * time.Millisecond,
+	FloodJitter:       20 * time.Millisecond,
+}
+
+// timeouts allow for the simulator's timers running late on a loaded
+// machine
+var timeouts = func() rfm69.Timeouts {
+	t := rfm69.DefaultTimeouts
+	t.PacketSentMargin = 250 * time.Millisecond
+	return t
+}()
+
+type node struct {
+	mesh  *Mesh
+	board *sim.Board
+	rx    chan *rfm69.Packet
+}
+
+// network builds nodes 1..n that can only hear the given neighbours.
+func network(t *testing.T, n int, links [][2]int) (*sim.Medium, map[int]*node) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	m := sim.NewMedium()
+	nodes := map[int]*node{}
+	for i := 1; i <= n; i++ {
+		b := m.NewBoard()
+		radio := rfm69.NewRadio(b, rfm69.WithAddress(byte(i)), rfm69.WithTimeouts(timeouts))
+		if err := radio.Setup(); err != nil {
+			t.Fatal(err)
+		}
+
+		nd := &node{mesh: New(radio, testConfig), board: b, rx: make(chan *rfm69.Packet, 16)}
+		go func() { _ = nd.mesh.RxContext(ctx, nd.rx) }()
+		nodes[i] = nd
+	}
+
+	linked := map[[2]int]bool{}
+	for _, l := range links {
+		linked[l] = true
+		linked[[2]int{l[1], l[0]}] = true
+	}
+	for i := 1; i <= n; i++ {
+		for j := i + 1; j <= n; j++ {
+			m.SetLink(nodes[i].board, nodes[j].board, linked[[2]int{i, j}])
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	return m, nodes
+}
+
+func expect(t *testing.T, nd *node, src byte, payload string) {
+	t.Helper()
+
+	select {
+	case p := <-nd.rx:
+		if p.Src != src || string(p.Payload) != payload {
+			t.Errorf("got %d %q, want %d %q", p.Src, p.Payload, src, payload)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("%q not delivered", payload)
+	}
+}
+
+func TestMeshRouting(t *testing.T) {
+	// 1 - 2 - 3 - 4
+	//      \     /
+	//       - 5 -
+	m, nodes := network(t, 5, [][2]int{{1, 2}, {2, 3}, {3, 4}, {2, 5}, {5, 4}})
+
+	if err := nodes[1].mesh.SendFrame(4, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, nodes[4], 1, "hello")
+
+	route, ok := nodes[1].mesh.Route(4)
+	if !ok || route.Next != 2 || route.Hops != 3 {
+		t.Errorf("route from 1 to 4 = %+v, %v", route, ok)
+	}
+
+	// and back, over the routes learned on the way
+	if err := nodes[4].mesh.SendFrame(1, []byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, nodes[1], 4, "reply")
+
+	// break the link 2 uses; it finds the other way round
+	via, ok := nodes[2].mesh.Route(4)
+	if !ok {
+		t.Fatal("2 has no route to 4")
+	}
+	m.SetLink(nodes[2].board, nodes[int(via.Next)].board, false)
+
+	if err := nodes[1].mesh.SendFrame(4, []byte("rerouted")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, nodes[4], 1, "rerouted")
+
+	if now, _ := nodes[2].mesh.Route(4); now.Next == via.Next {
+		t.Errorf("2 still routes to 4 through %d", via.Next)
+	}
+}
+
+func TestMeshUnreachable(t *testing.T) {
+	m, nodes := network(t, 3, [][2]int{{1, 2}, {2, 3}})
+
+	if err := nodes[1].mesh.SendFrame(3, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, nodes[3], 1, "first")
+
+	m.SetLink(nodes[2].board, nodes[3].board, false)
+
+	// the first hop still acks, but 2 reports the failure back
+	if err := nodes[1].mesh.SendFrame(3, []byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := nodes[1].mesh.Route(3); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("1 kept its route to 3")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// with no route, discovery fails
+	err := nodes[1].mesh.SendFrame(3, []byte("nowhere"))
+	if err == nil {
+		t.Fatal("send to an unreachable node succeeded")
+	}
+}
+
+func TestRouteExpiry(t *testing.T) {
+	rt := newRoutes(20 * time.Millisecond)
+
+	rt.learn(4, 2, 3)
+	if _, ok := rt.get(4); !ok {
+		t.Fatal("route not learned")
+	}
+
+	// a longer route doesn't displace a live one
+	rt.learn(4, 5, 4)
+	if r, _ := rt.get(4); r.Next != 2 {
+		t.Errorf("next = %d, want 2", r.Next)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := rt.get(4); ok {
+		t.Error("route did not expire")
+	}
+}
+
+func TestSeenCache(t *testing.T) {
+	c := newSeenCache(time.Minute)
+
+	// more frames than a byte of sequence number would tell apart
+	h := header{typ: msgData, origin: 2, seq: 0xfff0}
+	for i := 0; i < 1000; i++ {
+		if !c.add(h) {
+			t.Fatalf("seq %d taken for a duplicate", h.seq)
+		}
+		h.seq++
+	}
+
+	h.seq -= 500
+	if c.add(h) {
+		t.Errorf("seq %d not taken for a duplicate", h.seq)
+	}
+
+	b := h.append(nil)
+	if got, _, err := parseHeader(b); err != nil || got != h {
+		t.Errorf("header round trip: %+v, %v", got, err)
+	}
+}
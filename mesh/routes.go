@@ -0,0 +1,122 @@
+package mesh
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Route struct {
+	Dst     byte
+	Next    byte
+	Hops    byte
+	Expires time.Time
+}
+
+// routes is the routing table. Entries expire unless refreshed by
+// traffic, and anyone waiting for a route is woken when one is learned.
+type routes struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	table   map[byte]Route
+	waiters map[byte][]chan struct{}
+}
+
+func newRoutes(ttl time.Duration) *routes {
+	return &routes{
+		ttl:     ttl,
+		table:   map[byte]Route{},
+		waiters: map[byte][]chan struct{}{},
+	}
+}
+
+func (rt *routes) get(dst byte) (Route, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	route, ok := rt.table[dst]
+	if ok && time.Now().After(route.Expires) {
+		delete(rt.table, dst)
+		return Route{}, false
+	}
+	return route, ok
+}
+
+// learn records that dst is reachable through next. A known route is
+// only replaced by one that is no longer, unless it has expired.
+func (rt *routes) learn(dst, next, hops byte) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	now := time.Now()
+	if cur, ok := rt.table[dst]; ok && now.Before(cur.Expires) && cur.Hops < hops {
+		if cur.Next == next {
+			cur.Expires = now.Add(rt.ttl)
+			rt.table[dst] = cur
+		}
+		return
+	}
+
+	rt.table[dst] = Route{Dst: dst, Next: next, Hops: hops, Expires: now.Add(rt.ttl)}
+
+	for _, ch := range rt.waiters[dst] {
+		close(ch)
+	}
+	delete(rt.waiters, dst)
+}
+
+func (rt *routes) refresh(dst byte) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if route, ok := rt.table[dst]; ok {
+		route.Expires = time.Now().Add(rt.ttl)
+		rt.table[dst] = route
+	}
+}
+
+func (rt *routes) forget(dst byte) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.table, dst)
+}
+
+// forgetNext drops every route through next, after the link to it broke.
+func (rt *routes) forgetNext(next byte) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for dst, route := range rt.table {
+		if route.Next == next {
+			delete(rt.table, dst)
+		}
+	}
+}
+
+// wait returns a channel closed when a route to dst is learned.
+func (rt *routes) wait(dst byte) chan struct{} {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	ch := make(chan struct{})
+	rt.waiters[dst] = append(rt.waiters[dst], ch)
+	return ch
+}
+
+func (rt *routes) all() []Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	now := time.Now()
+	var result []Route
+	for dst, route := range rt.table {
+		if now.After(route.Expires) {
+			delete(rt.table, dst)
+			continue
+		}
+		result = append(result, route)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Dst < result[j].Dst })
+	return result
+}
@@ -0,0 +1,221 @@
+package rfm69
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	rssiBuckets = []float64{-120, -110, -100, -90, -80, -70, -60, -50, -40, -30}
+	feiBuckets  = []float64{-20000, -10000, -5000, -2000, -1000, 0, 1000, 2000, 5000, 10000, 20000}
+)
+
+// Metrics collects counters and distributions from a Radio. All methods
+// are safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	mu sync.Mutex
+
+	rxFrames     map[byte]uint64
+	txFrames     map[byte]uint64
+	fifoOverruns uint64
+	retries      uint64
+	timeouts     uint64
+	resets       uint64
+	duplicates   uint64
+	outOfOrders  uint64
+
+	rssi *histogram
+	fei  *histogram
+
+	mode      string
+	modeSince time.Time
+	modeTime  map[string]time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		rxFrames: map[byte]uint64{},
+		txFrames: map[byte]uint64{},
+		rssi:     newHistogram(rssiBuckets),
+		fei:      newHistogram(feiBuckets),
+		modeTime: map[string]time.Duration{},
+	}
+}
+
+func WithMetrics(m *Metrics) Option {
+	return func(r *Radio) {
+		r.metrics = m
+	}
+}
+
+func (m *Metrics) received(src byte, rssi int, fei int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rxFrames[src]++
+	m.rssi.observe(float64(rssi))
+	m.fei.observe(float64(fei))
+}
+
+func (m *Metrics) sent(dst byte) {
+	m.inc(func() { m.txFrames[dst]++ })
+}
+
+func (m *Metrics) fifoOverrun() { m.inc(func() { m.fifoOverruns++ }) }
+func (m *Metrics) retry()       { m.inc(func() { m.retries++ }) }
+func (m *Metrics) timeout()     { m.inc(func() { m.timeouts++ }) }
+func (m *Metrics) reset()       { m.inc(func() { m.resets++ }) }
+func (m *Metrics) duplicate()   { m.inc(func() { m.duplicates++ }) }
+func (m *Metrics) outOfOrder()  { m.inc(func() { m.outOfOrders++ }) }
+
+func (m *Metrics) inc(f func()) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f()
+}
+
+func (m *Metrics) enterMode(mode string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.mode != "" {
+		m.modeTime[m.mode] += now.Sub(m.modeSince)
+	}
+	m.mode, m.modeSince = mode, now
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	writeByPeer(cw, "rfm69_rx_frames_total", "Frames received, by sender.", "src", m.rxFrames)
+	writeByPeer(cw, "rfm69_tx_frames_total", "Frames sent, by destination.", "dst", m.txFrames)
+	writeCounter(cw, "rfm69_fifo_overruns_total", "FIFO overruns seen on receive.", m.fifoOverruns)
+	writeCounter(cw, "rfm69_retries_total", "Frames resent after a missing ack.", m.retries)
+	writeCounter(cw, "rfm69_timeouts_total", "Waits on the chip that timed out.", m.timeouts)
+	writeCounter(cw, "rfm69_resets_total", "Chip resets by the supervisor.", m.resets)
+	writeCounter(cw, "rfm69_duplicates_total", "Numbered frames dropped as duplicates.", m.duplicates)
+	writeCounter(cw, "rfm69_out_of_order_total", "Numbered frames that arrived late.", m.outOfOrders)
+	m.rssi.write(cw, "rfm69_rssi_dbm", "RSSI of received frames.")
+	m.fei.write(cw, "rfm69_fei_hz", "Frequency error of received frames.")
+
+	modeTime := make(map[string]time.Duration, len(m.modeTime)+1)
+	for mode, d := range m.modeTime {
+		modeTime[mode] = d
+	}
+	if m.mode != "" {
+		modeTime[m.mode] += time.Since(m.modeSince)
+	}
+
+	fmt.Fprintf(cw, "# HELP rfm69_mode_seconds_total Time spent in each operating mode.\n")
+	fmt.Fprintf(cw, "# TYPE rfm69_mode_seconds_total counter\n")
+	for _, mode := range sortedKeys(modeTime) {
+		fmt.Fprintf(cw, "rfm69_mode_seconds_total{mode=%q} %s\n", mode, formatFloat(modeTime[mode].Seconds()))
+	}
+
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+func writeCounter(w io.Writer, name, help string, val uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, val)
+}
+
+func writeByPeer(w io.Writer, name, help, label string, vals map[byte]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, peer := range sortedKeys(vals) {
+		fmt.Fprintf(w, "%s{%s=\"%d\"} %d\n", name, label, peer, vals[peer])
+	}
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, b := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[K byte | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
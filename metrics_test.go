@@ -0,0 +1,40 @@
+package rfm69
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	m.received(2, -85, 1200)
+	m.received(2, -45, -300)
+	m.sent(3)
+	m.timeout()
+
+	var nilMetrics *Metrics
+	nilMetrics.sent(3)
+	nilMetrics.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE rfm69_rx_frames_total counter\n",
+		`rfm69_rx_frames_total{src="2"} 2` + "\n",
+		`rfm69_tx_frames_total{dst="3"} 1` + "\n",
+		"rfm69_timeouts_total 1\n",
+		"# TYPE rfm69_rssi_dbm histogram\n",
+		`rfm69_rssi_dbm_bucket{le="-80"} 1` + "\n",
+		`rfm69_rssi_dbm_bucket{le="-40"} 2` + "\n",
+		`rfm69_rssi_dbm_bucket{le="+Inf"} 2` + "\n",
+		"rfm69_rssi_dbm_sum -130\n",
+		`rfm69_fei_hz_bucket{le="0"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package rfm69
+
+import (
+	"encoding/hex"
+	"io"
+	"log/slog"
+)
+
+type Config struct {
+	Band      byte // one of RF69_315MHZ, RF69_433MHZ, RF69_868MHZ, RF69_915MHZ
+	NetworkID byte
+	BitRate   int
+
+	// Frequency, in Hz, overrides the band's default carrier if set.
+	Frequency uint32
+}
+
+var DefaultConfig = Config{
+	Band:      RF69_433MHZ,
+	NetworkID: 100,
+	BitRate:   55555,
+}
+
+type Option func(r *Radio)
+
+// WithAddress sets the node's address, which Setup requires to pass
+// IsNodeAddr.
+func WithAddress(addr byte) Option {
+	return func(r *Radio) {
+		r.fromAddr = addr
+	}
+}
+
+func WithTxPower(dBm int) Option {
+	return func(r *Radio) {
+		r.txPower = dBm
+	}
+}
+
+func WithConfig(cfg Config) Option {
+	return func(r *Radio) {
+		r.cfg = cfg
+	}
+}
+
+// Config returns the configuration set by WithConfig.
+func (r *Radio) Config() Config {
+	return r.cfg
+}
+
+func WithLogger(log *slog.Logger) Option {
+	return func(r *Radio) {
+		r.log = log
+	}
+}
+
+func WithVariant(v Variant) Option {
+	return func(r *Radio) {
+		r.variant = v
+	}
+}
+
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(r *Radio) {
+		r.timeouts = timeouts
+	}
+}
+
+// WithATPC turns on automatic transmit power control. Each peer starts
+// at the configured transmit power and is adjusted within the variant's
+// power range from the RSSI reported in acks to SendWithRetry.
+func WithATPC(targetRSSI int) Option {
+	return func(r *Radio) {
+		r.atpcTarget = &targetRSSI
+	}
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{
+	Level: slog.Level(1 << 30),
+}))
+
+// hexBytes defers hex encoding until a handler actually records it.
+type hexBytes []byte
+
+func (b hexBytes) LogValue() slog.Value {
+	return slog.StringValue(hex.EncodeToString(b))
+}
@@ -1,5 +1,7 @@
 package rfm69
 
+import "time"
+
 //go:generate msgp
 
 type Packet struct {
@@ -7,4 +9,12 @@ type Packet struct {
 	Dst     byte
 	RSSI    int
 	Payload []byte
+
+	// Seq is the sender's sequence number, if HasSeq is set.
+	Seq    byte
+	HasSeq bool
+
+	// RxTime is when PayloadReady was signalled on DIO0, by the receiving
+	// radio's clock. It is not encoded.
+	RxTime time.Time `msg:"-"`
 }
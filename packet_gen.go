@@ -48,6 +48,18 @@ func (z *Packet) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "Payload")
 				return
 			}
+		case "Seq":
+			z.Seq, err = dc.ReadByte()
+			if err != nil {
+				err = msgp.WrapError(err, "Seq")
+				return
+			}
+		case "HasSeq":
+			z.HasSeq, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "HasSeq")
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -61,9 +73,9 @@ func (z *Packet) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Packet) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 4
+	// map header, size 6
 	// write "Src"
-	err = en.Append(0x84, 0xa3, 0x53, 0x72, 0x63)
+	err = en.Append(0x86, 0xa3, 0x53, 0x72, 0x63)
 	if err != nil {
 		return
 	}
@@ -102,15 +114,35 @@ func (z *Packet) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "Payload")
 		return
 	}
+	// write "Seq"
+	err = en.Append(0xa3, 0x53, 0x65, 0x71)
+	if err != nil {
+		return
+	}
+	err = en.WriteByte(z.Seq)
+	if err != nil {
+		err = msgp.WrapError(err, "Seq")
+		return
+	}
+	// write "HasSeq"
+	err = en.Append(0xa6, 0x48, 0x61, 0x73, 0x53, 0x65, 0x71)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.HasSeq)
+	if err != nil {
+		err = msgp.WrapError(err, "HasSeq")
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Packet) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 4
+	// map header, size 6
 	// string "Src"
-	o = append(o, 0x84, 0xa3, 0x53, 0x72, 0x63)
+	o = append(o, 0x86, 0xa3, 0x53, 0x72, 0x63)
 	o = msgp.AppendByte(o, z.Src)
 	// string "Dst"
 	o = append(o, 0xa3, 0x44, 0x73, 0x74)
@@ -121,6 +153,12 @@ func (z *Packet) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Payload"
 	o = append(o, 0xa7, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64)
 	o = msgp.AppendBytes(o, z.Payload)
+	// string "Seq"
+	o = append(o, 0xa3, 0x53, 0x65, 0x71)
+	o = msgp.AppendByte(o, z.Seq)
+	// string "HasSeq"
+	o = append(o, 0xa6, 0x48, 0x61, 0x73, 0x53, 0x65, 0x71)
+	o = msgp.AppendBool(o, z.HasSeq)
 	return
 }
 
@@ -166,6 +204,18 @@ func (z *Packet) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "Payload")
 				return
 			}
+		case "Seq":
+			z.Seq, bts, err = msgp.ReadByteBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Seq")
+				return
+			}
+		case "HasSeq":
+			z.HasSeq, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "HasSeq")
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -180,6 +230,6 @@ func (z *Packet) UnmarshalMsg(bts []byte) (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Packet) Msgsize() (s int) {
-	s = 1 + 4 + msgp.ByteSize + 4 + msgp.ByteSize + 5 + msgp.IntSize + 8 + msgp.BytesPrefixSize + len(z.Payload)
+	s = 1 + 4 + msgp.ByteSize + 4 + msgp.ByteSize + 5 + msgp.IntSize + 8 + msgp.BytesPrefixSize + len(z.Payload) + 4 + msgp.ByteSize + 7 + msgp.BoolSize
 	return
 }
@@ -0,0 +1,34 @@
+// Package pb holds the Protocol Buffers schema for rfm69 packets and the
+// Go types generated from it.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative packet.proto
+
+import "github.com/minor-industries/rfm69"
+
+func FromPacket(p *rfm69.Packet) *Packet {
+	x := &Packet{
+		Src:     uint32(p.Src),
+		Dst:     uint32(p.Dst),
+		Rssi:    int32(p.RSSI),
+		Payload: p.Payload,
+	}
+	if p.HasSeq {
+		seq := uint32(p.Seq)
+		x.Seq = &seq
+	}
+	return x
+}
+
+// ToPacket converts back to an rfm69.Packet. Addresses and sequence
+// numbers above 255 are truncated.
+func (x *Packet) ToPacket() *rfm69.Packet {
+	return &rfm69.Packet{
+		Src:     byte(x.GetSrc()),
+		Dst:     byte(x.GetDst()),
+		RSSI:    int(x.GetRssi()),
+		Payload: x.GetPayload(),
+		Seq:     byte(x.GetSeq()),
+		HasSeq:  x.Seq != nil,
+	}
+}
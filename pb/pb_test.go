@@ -0,0 +1,131 @@
+package pb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/minor-industries/rfm69"
+	"google.golang.org/protobuf/proto"
+)
+
+var packets = []*rfm69.Packet{
+	{Src: 1, Dst: 2, RSSI: -60, Payload: []byte("hello")},
+	{Src: 255, Dst: 0, RSSI: 0, Payload: []byte{}},
+	{Src: 7, Dst: 1, RSSI: -127, Payload: bytes.Repeat([]byte{0xA5}, 61)},
+	{Src: 3, Dst: 1, RSSI: -80, Payload: []byte{1}, Seq: 0, HasSeq: true},
+	{Src: 3, Dst: 1, RSSI: -80, Payload: []byte{2}, Seq: 200, HasSeq: true},
+}
+
+func equal(a, b *rfm69.Packet) bool {
+	return a.Src == b.Src && a.Dst == b.Dst && a.RSSI == b.RSSI && bytes.Equal(a.Payload, b.Payload) &&
+		a.Seq == b.Seq && a.HasSeq == b.HasSeq
+}
+
+// TestCrossEncoding passes each packet through every encoding in turn,
+// starting and ending with msgp.
+func TestCrossEncoding(t *testing.T) {
+	for _, want := range packets {
+		b, err := want.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p rfm69.Packet
+		if _, err := p.UnmarshalMsg(b); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = rfm69.Packet{}
+		if err := json.Unmarshal(b, &p); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = p.MarshalJSONBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = rfm69.Packet{}
+		if err := json.Unmarshal(b, &p); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = cbor.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = rfm69.Packet{}
+		if err := cbor.Unmarshal(b, &p); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err = proto.Marshal(FromPacket(&p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var x Packet
+		if err := proto.Unmarshal(b, &x); err != nil {
+			t.Fatal(err)
+		}
+
+		got := x.ToPacket()
+		msgp, err := got.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig, _ := want.MarshalMsg(nil)
+
+		if !equal(got, want) || !bytes.Equal(msgp, orig) {
+			t.Errorf("round trip gave %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	p := rfm69.Packet{Src: 1, Dst: 2, RSSI: -60, Payload: []byte{0xDE, 0xAD}}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"src":1,"dst":2,"rssi":-60,"payload":"dead"}`; string(b) != want {
+		t.Errorf("json = %s, want %s", b, want)
+	}
+
+	b, err = p.MarshalJSONBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"src":1,"dst":2,"rssi":-60,"payload_base64":"3q0="}`; string(b) != want {
+		t.Errorf("json = %s, want %s", b, want)
+	}
+
+	p.Seq, p.HasSeq = 9, true
+	if b, _ = json.Marshal(p); string(b) != `{"src":1,"dst":2,"rssi":-60,"seq":9,"payload":"dead"}` {
+		t.Errorf("json with seq = %s", b)
+	}
+
+	var q rfm69.Packet
+	if err := json.Unmarshal([]byte(`{"src":1,"payload":"00","payload_base64":"AA=="}`), &q); err == nil {
+		t.Error("accepted both payload forms")
+	}
+}
+
+func TestCBORDeterministic(t *testing.T) {
+	p := rfm69.Packet{Src: 1, Dst: 2, RSSI: -60, Payload: []byte{0xDE, 0xAD}}
+
+	b, err := cbor.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {1: 1, 2: 2, 3: -60, 4: h'dead'}
+	want := []byte{0xA4, 0x01, 0x01, 0x02, 0x02, 0x03, 0x38, 0x3B, 0x04, 0x42, 0xDE, 0xAD}
+	if !bytes.Equal(b, want) {
+		t.Errorf("cbor = %x, want %x", b, want)
+	}
+}
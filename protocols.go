@@ -0,0 +1,18 @@
+package rfm69
+
+// Layers sharing a radio tell their frames apart by the first payload
+// byte. Values from ProtoFirst up are reserved for the protocols in this
+// module; the app package hands out message IDs below it.
+//
+// secure and mesh take the whole payload instead, and what they carry
+// starts afresh: a secure frame starts with its key epoch, 0xFF for key
+// management, and a mesh frame with its routing header.
+const (
+	ProtoFirst = 0xC0
+
+	ProtoRPCRequest  = 0xC0
+	ProtoRPCResponse = 0xC1
+	ProtoTimesync    = 0xC2
+	ProtoTDMA        = 0xC3
+	ProtoFHSS        = 0xC4
+)
@@ -0,0 +1,179 @@
+package remote
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Client is an rfm69.Board backed by a Server.
+//
+// Writes that do not need bytes read back are pipelined: TxSPI returns
+// without waiting for the server, and writes made while an earlier batch
+// is still going out are sent together. Failures surface on the next
+// call that does wait.
+type Client struct {
+	conn net.Conn
+
+	mu sync.Mutex // serializes requests
+
+	pmu     sync.Mutex
+	pending []byte
+	kick    chan struct{}
+
+	replies chan frame
+	edges   chan struct{}
+
+	done    chan struct{}
+	readErr error
+}
+
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial")
+	}
+	return NewClient(conn), nil
+}
+
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		kick:    make(chan struct{}, 1),
+		replies: make(chan frame, 1),
+		edges:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	go c.read()
+	go c.flush()
+	return c
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) read() {
+	rd := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(rd)
+		if err != nil {
+			c.readErr = err
+			close(c.done)
+			return
+		}
+
+		if f.typ == frameEdge {
+			select {
+			case c.edges <- struct{}{}:
+			default:
+			}
+			continue
+		}
+
+		c.replies <- f
+	}
+}
+
+// flush sends whatever has been queued since the last batch went out.
+func (c *Client) flush() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.kick:
+		}
+
+		c.pmu.Lock()
+		buf := c.pending
+		c.pending = nil
+		c.pmu.Unlock()
+
+		if _, err := c.conn.Write(buf); err != nil {
+			// the reader notices and fails pending calls
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+func (c *Client) queue(typ byte, body []byte) error {
+	if len(body) > maxBody {
+		return errors.New("frame too large")
+	}
+
+	c.pmu.Lock()
+	c.pending = appendFrame(c.pending, typ, body)
+	c.pmu.Unlock()
+
+	select {
+	case c.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *Client) TxSPI(w, r []byte) error {
+	if r == nil {
+		if err := c.alive(); err != nil {
+			return err
+		}
+		return c.queue(frameWrite, w)
+	}
+
+	body, err := c.call(frameTransfer, w)
+	if err != nil {
+		return err
+	}
+	copy(r, body)
+	return nil
+}
+
+func (c *Client) Reset(active bool) error {
+	var val byte
+	if active {
+		val = 1
+	}
+	_, err := c.call(frameReset, []byte{val})
+	return err
+}
+
+// WaitForD0Edge blocks until the server reports an edge. If the
+// connection is lost it blocks forever; requests report the failure.
+func (c *Client) WaitForD0Edge() {
+	<-c.edges
+}
+
+func (c *Client) call(typ byte, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.alive(); err != nil {
+		return nil, err
+	}
+	if err := c.queue(typ, body); err != nil {
+		return nil, err
+	}
+
+	select {
+	case f := <-c.replies:
+		if f.typ == frameError {
+			return nil, errors.New(string(f.body))
+		}
+		return f.body, nil
+	case <-c.done:
+		return nil, errors.Wrap(c.readErr, "connection lost")
+	}
+}
+
+func (c *Client) alive() error {
+	select {
+	case <-c.done:
+		return errors.Wrap(c.readErr, "connection lost")
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+// Package remote exposes a Board over the network, so a Radio can run on
+// one machine against a module attached to another.
+//
+// The protocol is a stream of frames, each a type byte and a big endian
+// uint16 length followed by the body. The client sends:
+//
+//	'W'  SPI write; no reply
+//	'X'  SPI transfer; replied to with 'R' (the bytes read) or 'E'
+//	'S'  reset, body 0 or 1; replied to with 'R' or 'E'
+//
+// and the server sends 'R' and 'E' replies, in order, interleaved with
+// 'I' frames for each DIO0 edge. A failed write is reported by the 'E'
+// reply to the next request.
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	frameWrite    = 'W'
+	frameTransfer = 'X'
+	frameReset    = 'S'
+	frameResult   = 'R'
+	frameError    = 'E'
+	frameEdge     = 'I'
+)
+
+const maxBody = 0xFFFF
+
+type frame struct {
+	typ  byte
+	body []byte
+}
+
+func appendFrame(b []byte, typ byte, body []byte) []byte {
+	b = append(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	return append(b, body...)
+}
+
+func writeFrame(w *bufio.Writer, typ byte, body []byte) error {
+	if len(body) > maxBody {
+		return errors.New("frame too large")
+	}
+	_, err := w.Write(appendFrame(nil, typ, body))
+	return err
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return frame{}, err
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(hdr[1:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return frame{}, errors.Wrap(err, "truncated frame")
+	}
+
+	return frame{typ: hdr[0], body: body}, nil
+}
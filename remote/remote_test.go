@@ -0,0 +1,127 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+	"github.com/pkg/errors"
+)
+
+func serve(t *testing.T, board rfm69.Board) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() { _ = NewServer(board).Serve(ln) }()
+	return ln.Addr().String()
+}
+
+func TestRemoteRadio(t *testing.T) {
+	m := sim.NewMedium()
+	addr := serve(t, m.NewBoard())
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	remote := rfm69.NewRadio(client, rfm69.WithAddress(1))
+	if err := remote.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.VerifyConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	local := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(2))
+	if err := local.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remoteRx := make(chan *rfm69.Packet, 4)
+	localRx := make(chan *rfm69.Packet, 4)
+	go func() { _ = remote.RxContext(ctx, remoteRx) }()
+	go func() { _ = local.RxContext(ctx, localRx) }()
+	time.Sleep(20 * time.Millisecond)
+
+	// interrupts are forwarded to the client
+	if err := local.SendFrame(1, []byte("to remote")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-remoteRx:
+		if p.Src != 2 || string(p.Payload) != "to remote" {
+			t.Errorf("remote got %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("remote received nothing")
+	}
+
+	// and acks round trip through both
+	if err := remote.SendWithRetry(2, []byte("from remote"), 2, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-localRx:
+		if p.Src != 1 || string(p.Payload) != "from remote" {
+			t.Errorf("local got %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("local received nothing")
+	}
+}
+
+// failWrites fails SPI transactions that read nothing back.
+type failWrites struct {
+	rfm69.Board
+}
+
+func (b failWrites) TxSPI(w, r []byte) error {
+	if r == nil {
+		return errors.New("bus fault")
+	}
+	return b.Board.TxSPI(w, r)
+}
+
+func TestDeferredWriteError(t *testing.T) {
+	m := sim.NewMedium()
+	addr := serve(t, failWrites{m.NewBoard()})
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the write is pipelined, so it cannot fail yet
+	if err := client.TxSPI([]byte{rfm69.REG_SYNCVALUE1 | 0x80, 0xAA}, nil); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// the next reply carries the write's failure
+	err = client.TxSPI([]byte{rfm69.REG_SYNCVALUE1, 0}, make([]byte, 2))
+	if err == nil || !strings.Contains(err.Error(), "bus fault") {
+		t.Fatalf("read after failed write: %v", err)
+	}
+
+	rx := make([]byte, 2)
+	if err := client.TxSPI([]byte{rfm69.REG_VERSION, 0}, rx); err != nil {
+		t.Fatal(err)
+	}
+	if rx[1] != 0x24 {
+		t.Errorf("version = 0x%02x", rx[1])
+	}
+}
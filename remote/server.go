@@ -0,0 +1,143 @@
+package remote
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+// Server serves a local board to one client at a time. Further clients
+// are disconnected while one is active.
+type Server struct {
+	board rfm69.Board
+
+	busy atomic.Bool
+
+	edgeOnce sync.Once
+	edges    chan struct{}
+}
+
+func NewServer(board rfm69.Board) *Server {
+	return &Server{
+		board: board,
+		edges: make(chan struct{}, 1),
+	}
+}
+
+// Serve accepts connections on ln until it fails.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		if !s.busy.CompareAndSwap(false, true) {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer s.busy.Store(false)
+			_ = s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn handles requests on conn until it is closed.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	s.startEdges()
+
+	rd := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	var wmu sync.Mutex
+
+	send := func(typ byte, body []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+
+		if err := writeFrame(w, typ, body); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.edges:
+				if err := send(frameEdge, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// writeErr holds the first failure of a write nobody waited for
+	var writeErr error
+
+	reply := func(body []byte, err error) error {
+		if writeErr != nil {
+			err, writeErr = errors.Wrap(writeErr, "earlier write"), nil
+		}
+		if err != nil {
+			return send(frameError, []byte(err.Error()))
+		}
+		return send(frameResult, body)
+	}
+
+	for {
+		f, err := readFrame(rd)
+		if err != nil {
+			return err
+		}
+
+		switch f.typ {
+		case frameWrite:
+			if err := s.board.TxSPI(f.body, nil); err != nil && writeErr == nil {
+				writeErr = err
+			}
+		case frameTransfer:
+			rx := make([]byte, len(f.body))
+			err := s.board.TxSPI(f.body, rx)
+			if err := reply(rx, err); err != nil {
+				return err
+			}
+		case frameReset:
+			err := s.board.Reset(len(f.body) > 0 && f.body[0] != 0)
+			if err := reply(nil, err); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unknown frame type %q", f.typ)
+		}
+	}
+}
+
+// startEdges starts the goroutine that waits on the board's DIO0. It
+// outlives connections since WaitForD0Edge cannot be interrupted; edges
+// that arrive with no client connected are dropped.
+func (s *Server) startEdges() {
+	s.edgeOnce.Do(func() {
+		go func() {
+			for {
+				s.board.WaitForD0Edge()
+				select {
+				case s.edges <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	})
+}
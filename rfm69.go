@@ -2,12 +2,17 @@ package rfm69
 
 import (
 	"bytes"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Board is the hardware a Radio drives. TxSPI clocks out w while reading
+// into r; r is nil when the caller does not need the bytes read back.
 type Board interface {
 	TxSPI(w, r []byte) error
 	Reset(bool) error
@@ -16,47 +21,107 @@ type Board interface {
 
 type Radio struct {
 	board    Board
-	log      func(string)
+	log      *slog.Logger
 	fromAddr byte
 	txPower  int
+	cfg      Config
+	variant  Variant
+	version  byte
+	timeouts Timeouts
+	regs     map[byte]byte
+	config   [][2]byte
+	aesKey   []byte
+
+	// mu serializes access to the chip. Rx holds it except while waiting
+	// for an interrupt, so transmits slot in between received frames.
+	mu sync.Mutex
+
+	receiving atomic.Bool
+	asleep    bool
+	intrOnce  sync.Once
+	intr      chan struct{}
+	lastEdge  atomic.Pointer[time.Time]
+	clock     Clock
+
+	metrics *Metrics
+	capture *CaptureWriter
+
+	filtering bool
+	groups    map[byte]bool
+
+	seqOn bool
+	seq   byte
+	seqs  seqTracker
+
+	acks       ackWaiters
+	atpc       *atpc
+	atpcTarget *int
+	powerLimit *int
 }
 
-func NewRadio(
-	board Board,
-	log func(string),
-	fromAddr byte,
-	txPower int,
-) *Radio {
-	return &Radio{
+func NewRadio(board Board, opts ...Option) *Radio {
+	r := &Radio{
 		board:    board,
-		log:      log,
-		fromAddr: fromAddr,
-		txPower:  txPower,
+		log:      discardLogger,
+		txPower:  13,
+		cfg:      DefaultConfig,
+		variant:  VariantHW,
+		timeouts: DefaultTimeouts,
+		regs:     map[byte]byte{},
+		clock:    systemClock{},
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.atpcTarget != nil {
+		lo, hi := r.variant.PowerRange()
+		r.atpc = newATPC(*r.atpcTarget, lo, hi, r.txPower)
+	}
+
+	return r
 }
 
 func (r *Radio) sync(val byte) error {
 	for i := 0; i < 15; i++ {
-		a, err := r.readRegReturningErrors(REG_SYNCVALUE1)
+		a, err := r.readReg(REG_SYNCVALUE1)
 		if err != nil {
 			return errors.Wrap(err, "read syncvalue1")
 		}
-		r.log(fmt.Sprintf("val = 0x%02x", a))
+		r.log.Debug("sync", "value", a)
 		if a == val {
 			return nil
 		}
-		if err := r.writeRegReturningErrors(REG_SYNCVALUE1, val); err != nil {
+		if err := r.writeReg(REG_SYNCVALUE1, val); err != nil {
 			return errors.Wrap(err, "write syncvalue1")
 		}
 	}
-	return errors.New("radio is not syncing")
+	return errors.Wrap(ErrNotResponding, "radio is not syncing")
 }
 
-func (r *Radio) SetMode(mode Mode) {
-	r.setMode(mode)
+func (r *Radio) SetMode(mode Mode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setMode(mode)
 }
 
-func (r *Radio) Setup(freq byte) error {
+func (r *Radio) Setup() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setup()
+}
+
+func (r *Radio) setup() error {
+	if !IsNodeAddr(r.fromAddr) {
+		return errors.Wrapf(ErrBadAddress, "0x%02x", r.fromAddr)
+	}
+	if err := r.cfg.validate(); err != nil {
+		return err
+	}
+
 	if err := r.board.Reset(true); err != nil {
 		return errors.Wrap(err, "reset")
 	}
@@ -69,6 +134,10 @@ func (r *Radio) Setup(freq byte) error {
 
 	time.Sleep(5 * time.Millisecond)
 
+	if err := r.checkVersion(); err != nil {
+		return errors.Wrap(err, "check version")
+	}
+
 	if err := r.sync(0xAA); err != nil {
 		return errors.Wrap(err, "sync 1")
 	}
@@ -77,111 +146,292 @@ func (r *Radio) Setup(freq byte) error {
 		return errors.Wrap(err, "sync 2")
 	}
 
-	r.SetPowerDBm(13)
+	if err := r.setPowerDBm(13); err != nil {
+		return errors.Wrap(err, "set power")
+	}
 
 	if err := r.setConfig(
-		getConfig(RF69_433MHZ, 100),
+		getConfig(r.cfg),
 	); err != nil {
 		return errors.Wrap(err, "set config")
 	}
+	if err := r.applyAddressFilter(); err != nil {
+		return err
+	}
+	r.metrics.enterMode(ModeStandby.String())
 
 	return nil
 }
 
 func (r *Radio) Rx(out chan<- *Packet) error {
-	intrCh := make(chan struct{})
-	errCh := make(chan error)
+	return r.RxContext(context.Background(), out)
+}
+
+func (r *Radio) RxContext(ctx context.Context, out chan<- *Packet) error {
+	if !r.receiving.CompareAndSwap(false, true) {
+		return errors.Wrap(ErrBusy, "rx already running")
+	}
+	defer r.receiving.Store(false)
+
+	r.startInterrupts()
 
-	go func() {
-		for {
-			r.board.WaitForD0Edge()
-			intrCh <- struct{}{}
+	for {
+		r.mu.Lock()
+		err := r.beginReceive()
+		r.mu.Unlock()
+		if err != nil {
+			return errors.Wrap(err, "begin receive")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.intr:
+		}
+		r.log.Debug("got interrupt")
+
+		p, err := r.receive()
+		if err != nil {
+			return err
 		}
-	}()
-
-	go func() {
-		for {
-			err := r.beginReceive()
-			if err != nil {
-				errCh <- errors.Wrap(err, "begin receive")
-				return
+		if p == nil {
+			continue
+		}
+
+		select {
+		case out <- p:
+		case <-ctx.Done():
+			// the frame has left the FIFO; hand it over if there's room
+			select {
+			case out <- p:
+			default:
+				r.log.Warn("rx cancelled, packet dropped", "src", p.Src)
 			}
+			return ctx.Err()
+		}
+	}
+}
 
-			<-intrCh
-			r.log("got interrupt")
+// Sleep puts the chip in sleep mode until Wake. A running Rx hears
+// nothing meanwhile, and the chip goes back to sleep after sending.
+func (r *Radio) Sleep() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-			rssi := r.readRSSI()
-			r.log(fmt.Sprintf("rssi = %d", rssi))
+	r.asleep = true
+	return r.setMode(ModeSleep)
+}
 
-			tx := []byte{REG_FIFO & 0x7f, 0, 0, 0, 0}
-			rx := make([]byte, len(tx))
+// Wake ends Sleep, resuming a running Rx.
+func (r *Radio) Wake() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-			if err := r.board.TxSPI(
-				tx,
-				rx,
-			); err != nil {
-				errCh <- errors.Wrap(err, "txspi")
-				return
-			}
+	r.asleep = false
+	if r.receiving.Load() {
+		return r.beginReceive()
+	}
+	return r.setMode(ModeStandby)
+}
 
-			rx = rx[1:]
-			r.log("rx: " + hex.Dump(rx))
-
-			payloadLength := rx[0]
-			targetID := rx[1]
-			senderID := rx[2]
-			ctlByte := rx[3]
-
-			r.log(fmt.Sprintf(
-				"len=%d, target=0x%02x, sender=0x%02x, ctl=0x%02x",
-				payloadLength,
-				targetID,
-				senderID,
-				ctlByte,
-			))
-
-			dataLength := payloadLength - 3
-
-			{
-				tx := []byte{REG_FIFO & 0x7f}
-				tx = append(tx, bytes.Repeat([]byte{0}, int(dataLength))...)
-				rx := make([]byte, len(tx))
-				if err := r.board.TxSPI(tx, rx); err != nil {
-					errCh <- errors.Wrap(err, "spi")
-					return
-				}
-				rx = rx[1:]
-				r.log("data: " + hex.Dump(rx))
-
-				out <- &Packet{
-					Src:     senderID,
-					Dst:     targetID,
-					RSSI:    rssi,
-					Payload: rx,
+// Address returns the node address frames are sent from.
+func (r *Radio) Address() byte {
+	return r.fromAddr
+}
+
+// Receiving reports whether Rx is running.
+func (r *Radio) Receiving() bool {
+	return r.receiving.Load()
+}
+
+// receive reads a frame after an interrupt, handling acks internally. It
+// returns nil if there was nothing for the caller.
+func (r *Radio) receive() (*Packet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ctl, err := r.receivePacket()
+	if err != nil {
+		return nil, errors.Wrap(err, "receive packet")
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	if !r.accepts(p.Dst) {
+		return nil, nil
+	}
+
+	if ctl&RF69_CTL_SENDACK != 0 {
+		r.handleAck(p, ctl)
+		return nil, nil
+	}
+
+	// broadcast and group frames are never acked
+	if ctl&RF69_CTL_REQACK != 0 && p.Dst == r.fromAddr && IsNodeAddr(p.Dst) {
+		// the frame itself arrived fine, and the sender will retry
+		if err := r.sendAck(p, ctl); err != nil {
+			r.log.Warn("send ack failed", "dst", p.Src, "err", err)
+		}
+	}
+
+	// duplicates are still acked above, since the first ack was lost
+	if p.HasSeq {
+		switch r.seqs.check(p.Src, p.Seq, r.clock.Now()) {
+		case seqDuplicate:
+			r.log.Debug("duplicate", "src", p.Src, "seq", p.Seq)
+			r.metrics.duplicate()
+			return nil, nil
+		case seqLate:
+			r.metrics.outOfOrder()
+		}
+	}
+
+	return p, nil
+}
+
+// startInterrupts starts the single goroutine that forwards DIO0 edges
+// from the board. It outlives any one call to Rx, since WaitForD0Edge
+// cannot be interrupted.
+func (r *Radio) startInterrupts() {
+	r.intrOnce.Do(func() {
+		r.intr = make(chan struct{}, 1)
+		go func() {
+			for {
+				r.board.WaitForD0Edge()
+				now := r.clock.Now()
+				r.lastEdge.Store(&now)
+				select {
+				case r.intr <- struct{}{}:
+				default:
 				}
 			}
-		}
-	}()
+		}()
+	})
+}
+
+func (r *Radio) receivePacket() (*Packet, byte, error) {
+	flags, err := r.readReg(REG_IRQFLAGS2)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "read irqflags2")
+	}
+	if flags&RF_IRQFLAGS2_FIFOOVERRUN != 0 {
+		r.metrics.fifoOverrun()
+	}
+	if flags&RF_IRQFLAGS2_PAYLOADREADY == 0 {
+		// stale edge, e.g. left over from a previous mode
+		return nil, 0, nil
+	}
+
+	crcOn := r.configReg(REG_PACKETCONFIG1, RF_PACKET1_CRC_ON)&RF_PACKET1_CRC_ON != 0
+	if crcOn && flags&RF_IRQFLAGS2_CRCOK == 0 {
+		// only seen with CrcAutoClear off; beginReceive restarts RX
+		return nil, 0, nil
+	}
+
+	rssi, err := r.readRSSI()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "read rssi")
+	}
+
+	fei, err := r.readFEI()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "read fei")
+	}
+
+	tx := []byte{REG_FIFO & 0x7f, 0, 0, 0, 0}
+	rx := make([]byte, len(tx))
+
+	if err := r.board.TxSPI(
+		tx,
+		rx,
+	); err != nil {
+		return nil, 0, errors.Wrap(err, "txspi")
+	}
+
+	rx = rx[1:]
 
-	return errors.Wrap(<-errCh, "error channel")
+	payloadLength := rx[0]
+	targetID := rx[1]
+	senderID := rx[2]
+	ctlByte := rx[3]
+
+	r.log.Debug(
+		"rx header",
+		"len", payloadLength,
+		"dst", targetID,
+		"src", senderID,
+		"ctl", ctlByte,
+		"rssi", rssi,
+	)
+
+	if payloadLength < 3 {
+		return nil, 0, nil
+	}
+	dataLength := payloadLength - 3
+
+	tx = []byte{REG_FIFO & 0x7f}
+	tx = append(tx, bytes.Repeat([]byte{0}, int(dataLength))...)
+	rx = make([]byte, len(tx))
+	if err := r.board.TxSPI(tx, rx); err != nil {
+		return nil, 0, errors.Wrap(err, "spi")
+	}
+	rx = rx[1:]
+	r.log.Debug("rx data", "src", senderID, "data", hexBytes(rx))
+	r.metrics.received(senderID, rssi, fei)
+	r.captureFrame(DirectionRx, rssi, append([]byte{payloadLength, targetID, senderID, ctlByte}, rx...))
+
+	p := &Packet{
+		Src:     senderID,
+		Dst:     targetID,
+		RSSI:    rssi,
+		Payload: rx,
+		RxTime:  r.edgeTime(),
+	}
+	splitSeq(p, ctlByte)
+
+	return p, ctlByte, nil
 }
 
 func (r *Radio) beginReceive() error {
-	if r.readReg(REG_IRQFLAGS2)&RF_IRQFLAGS2_PAYLOADREADY != 0 {
+	if r.asleep {
+		return r.setMode(ModeSleep)
+	}
+
+	flags, err := r.readReg(REG_IRQFLAGS2)
+	if err != nil {
+		return errors.Wrap(err, "read irqflags2")
+	}
+
+	if flags&RF_IRQFLAGS2_PAYLOADREADY != 0 {
 		// avoid RX deadlocks??
-		r.editReg(REG_PACKETCONFIG2, func(val byte) byte {
+		if err := r.editReg(REG_PACKETCONFIG2, func(val byte) byte {
 			return val&0xFB | RF_PACKET2_RXRESTART
-		})
+		}); err != nil {
+			return errors.Wrap(err, "restart rx")
+		}
 	}
 
-	r.writeReg(REG_DIOMAPPING1, RF_DIOMAPPING1_DIO0_01)
-	r.editReg(REG_OPMODE, func(val byte) byte {
+	if err := r.writeReg(REG_DIOMAPPING1, RF_DIOMAPPING1_DIO0_01); err != nil {
+		return errors.Wrap(err, "set dio mapping")
+	}
+
+	if err := r.editReg(REG_OPMODE, func(val byte) byte {
 		return val&0xE3 | RF_OPMODE_RECEIVER
-	})
+	}); err != nil {
+		return errors.Wrap(err, "set receiver mode")
+	}
+	r.metrics.enterMode("rx")
 
-	// set low power regs
-	r.writeReg(REG_TESTPA1, 0x55)
-	r.writeReg(REG_TESTPA2, 0x70)
+	if r.variant == VariantHW {
+		// set low power regs
+		if err := r.writeReg(REG_TESTPA1, 0x55); err != nil {
+			return errors.Wrap(err, "set testpa1")
+		}
+		if err := r.writeReg(REG_TESTPA2, 0x70); err != nil {
+			return errors.Wrap(err, "set testpa2")
+		}
+	}
 
 	return nil
 }
@@ -192,55 +442,118 @@ const (
 	ModeStandby Mode = iota + 1
 	ModeTx      Mode = iota + 1
 	ModeSleep   Mode = iota + 1
+	ModeRx      Mode = iota + 1
 )
 
-func (r *Radio) setMode(mode Mode) {
-	switch mode {
+func (m Mode) String() string {
+	switch m {
 	case ModeStandby:
-		r.editReg(REG_OPMODE, func(val byte) byte {
-			return val&0xE3 | RF_OPMODE_STANDBY
-		})
+		return "standby"
 	case ModeTx:
-		r.editReg(REG_OPMODE, func(val byte) byte {
-			return val&0xE3 | RF_OPMODE_TRANSMITTER
-		})
+		return "tx"
 	case ModeSleep:
-		r.editReg(REG_OPMODE, func(val byte) byte {
-			return val&0xE3 | RF_OPMODE_SLEEP
-		})
+		return "sleep"
+	case ModeRx:
+		return "rx"
 	default:
-		panic("unknown mode")
+		return fmt.Sprintf("Mode(%d)", int(m))
 	}
 }
 
-func (r *Radio) waitForModeReady() {
-	for r.readReg(REG_IRQFLAGS1)&RF_IRQFLAGS1_MODEREADY == 0x00 {
+func (r *Radio) setMode(mode Mode) error {
+	var opMode byte
+
+	switch mode {
+	case ModeStandby:
+		opMode = RF_OPMODE_STANDBY
+	case ModeTx:
+		opMode = RF_OPMODE_TRANSMITTER
+	case ModeSleep:
+		opMode = RF_OPMODE_SLEEP
+	case ModeRx:
+		opMode = RF_OPMODE_RECEIVER
+	default:
+		return fmt.Errorf("unknown mode %d", mode)
+	}
+
+	if err := r.editReg(REG_OPMODE, func(val byte) byte {
+		return val&0xE3 | opMode
+	}); err != nil {
+		return err
 	}
+
+	r.metrics.enterMode(mode.String())
+	return nil
+}
+
+func (r *Radio) waitForModeReady() error {
+	return r.waitForFlag(REG_IRQFLAGS1, RF_IRQFLAGS1_MODEREADY, r.timeouts.ModeReady)
 }
 
 func (r *Radio) SendFrame(
 	toAddr byte,
 	msg []byte,
 ) error {
-	r.setMode(ModeStandby)
-	r.waitForModeReady()
-	r.clearFIFO()
-	r.SetPowerDBm(r.txPower)
-	r.writeReg(REG_DIOMAPPING1, RF_DIOMAPPING1_DIO0_00)
+	ctl, msg := r.withSeq(0x00, msg)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sendFrame(toAddr, ctl, msg)
+}
+
+func (r *Radio) sendFrame(
+	toAddr byte,
+	ctl byte,
+	msg []byte,
+) error {
+	return r.sendStamped(toAddr, ctl, msg, nil)
+}
 
-	ack := byte(0x00)
+func (r *Radio) sendStamped(
+	toAddr byte,
+	ctl byte,
+	msg []byte,
+	stamp func(now time.Time),
+) error {
+	// msg already carries any sequence number
+	if len(msg) > RF69_MAX_DATA_LEN {
+		return errors.Wrapf(ErrPayloadTooLarge, "%d bytes", len(msg))
+	}
+
+	if err := r.setMode(ModeStandby); err != nil {
+		return errors.Wrap(err, "set standby")
+	}
+	if err := r.waitForModeReady(); err != nil {
+		return errors.Wrap(err, "wait for standby")
+	}
+	if err := r.clearFIFO(); err != nil {
+		return errors.Wrap(err, "clear fifo")
+	}
+	if err := r.setPowerDBm(r.peerPower(toAddr)); err != nil {
+		return errors.Wrap(err, "set power")
+	}
+	if err := r.writeReg(REG_DIOMAPPING1, RF_DIOMAPPING1_DIO0_00); err != nil {
+		return errors.Wrap(err, "set dio mapping")
+	}
+
+	if stamp != nil {
+		stamp(r.clock.Now())
+	}
 
 	tx := []byte{
 		REG_FIFO | 0x80,
 		byte(len(msg) + 3),
 		toAddr,
 		r.fromAddr,
-		ack,
+		ctl,
 	}
 
 	tx = append(tx, msg...)
 	//tx = append(tx, 0)
 
+	r.log.Debug("tx", "dst", toAddr, "ctl", ctl, "data", hexBytes(msg))
+
 	if err := r.board.TxSPI(
 		tx,
 		nil,
@@ -248,71 +561,102 @@ func (r *Radio) SendFrame(
 		return errors.Wrap(err, "tx spi")
 	}
 
-	r.setMode(ModeTx)
-	r.waitForPacketSent()
+	if err := r.setMode(ModeTx); err != nil {
+		return errors.Wrap(err, "set tx")
+	}
+	if err := r.waitForPacketSent(len(msg)); err != nil {
+		return errors.Wrap(err, "wait for packet sent")
+	}
+	r.metrics.sent(toAddr)
+	r.captureFrame(DirectionTx, 0, tx[1:])
 
-	r.setMode(ModeStandby)
-	r.waitForModeReady()
-	r.SetPowerDBm(-2)
+	if err := r.setMode(ModeStandby); err != nil {
+		return errors.Wrap(err, "set standby")
+	}
+	if err := r.waitForModeReady(); err != nil {
+		return errors.Wrap(err, "wait for standby")
+	}
+	if err := r.setPowerDBm(-2); err != nil {
+		return errors.Wrap(err, "set power")
+	}
+
+	// hand the chip back to a running Rx, or back to sleep
+	if r.receiving.Load() || r.asleep {
+		if err := r.beginReceive(); err != nil {
+			return errors.Wrap(err, "resume receive")
+		}
+	}
 
 	return nil
 }
 
 func (r *Radio) setConfig(config [][2]byte) error {
 	for _, kv := range config {
-		r.log(fmt.Sprintf("config 0x%02x = 0x%02x", kv[0], kv[1]))
-		r.writeReg(kv[0], kv[1])
+		r.log.Debug("config", "register", RegisterName(kv[0]), "value", kv[1])
+		if err := r.writeReg(kv[0], kv[1]); err != nil {
+			return err
+		}
+		r.regs[kv[0]] = kv[1]
 	}
+	r.config = config
 
 	return nil
 }
 
-func (r *Radio) readRegReturningErrors(addr byte) (byte, error) {
+func (r *Radio) readReg(addr byte) (byte, error) {
 	rx := make([]byte, 2)
 
 	if err := r.board.TxSPI(
 		[]byte{addr & 0x7F, 0},
 		rx,
 	); err != nil {
-		return 0, errors.Wrap(err, "tx")
+		return 0, &RegisterError{Op: "read", Addr: addr, Err: err}
 	}
 
 	return rx[1], nil
 }
 
-func (r *Radio) readReg(addr byte) byte {
-	val, _ := r.readRegReturningErrors(addr)
-	return val
-}
-
-func (r *Radio) writeRegReturningErrors(addr byte, value byte) error {
-	rx := make([]byte, 2)
-
+func (r *Radio) writeReg(addr byte, value byte) error {
 	if err := r.board.TxSPI(
 		[]byte{addr | 0x80, value},
-		rx,
+		nil,
 	); err != nil {
-		return errors.Wrap(err, "tx")
+		return &RegisterError{Op: "write", Addr: addr, Err: err}
 	}
 	return nil
 }
 
-func (r *Radio) writeReg(addr byte, value byte) {
-	_ = r.writeRegReturningErrors(addr, value)
-}
-
 func (r *Radio) editReg(
 	addr byte,
 	edit func(val byte) byte,
-) {
-	val := r.readReg(addr)
-	newVal := edit(val)
-	r.writeReg(addr, newVal)
+) error {
+	val, err := r.readReg(addr)
+	if err != nil {
+		return err
+	}
+	return r.writeReg(addr, edit(val))
 }
 
-func (r *Radio) readRSSI() int {
-	val := int(r.readReg(REG_RSSIVALUE)) * -1
-	return val / 2
+// readFEI returns the last frequency error estimate in Hz.
+func (r *Radio) readFEI() (int, error) {
+	msb, err := r.readReg(REG_FEIMSB)
+	if err != nil {
+		return 0, err
+	}
+	lsb, err := r.readReg(REG_FEILSB)
+	if err != nil {
+		return 0, err
+	}
+	fei := int(int16(uint16(msb)<<8 | uint16(lsb)))
+	return fei * fxosc >> 19, nil
+}
+
+func (r *Radio) readRSSI() (int, error) {
+	val, err := r.readReg(REG_RSSIVALUE)
+	if err != nil {
+		return 0, err
+	}
+	return int(val) * -1 / 2, nil
 }
 
 type levelSetting struct {
@@ -347,36 +691,163 @@ var powerLevelSettings = map[int]levelSetting{
 	20: {31, true, true},
 }
 
-func (r *Radio) SetPowerDBm(val int) {
-	val = max(val, -2)
-	val = min(val, 20)
+// SetPowerDBm sets the transmit power used for subsequent frames, unless
+// ATPC is picking a level per peer.
+func (r *Radio) SetPowerDBm(val int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lo, hi := r.variant.PowerRange()
+	r.txPower = min(max(val, lo), hi)
+	return r.setPowerDBm(r.txPower)
+}
+
+// TxPower returns the transmit power, in dBm, set by WithTxPower or
+// SetPowerDBm.
+func (r *Radio) TxPower() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.txPower
+}
+
+func (r *Radio) setPowerDBm(val int) error {
+	lo, hi := r.variant.PowerRange()
+	val = max(val, lo)
+	val = min(val, hi)
 
 	settings := powerLevelSettings[val]
 
-	if settings.highPower {
-		r.writeReg(REG_OCP, RF_OCP_OFF)
-		r.writeReg(REG_PALEVEL, settings.paLevel|RF_PALEVEL_PA1_ON|RF_PALEVEL_PA2_ON)
-		r.writeReg(REG_TESTPA1, 0x5D)
-		r.writeReg(REG_TESTPA2, 0x7C)
+	var regs [][2]byte
+
+	if r.variant == VariantW {
+		// PA0 only: Pout = -18 + OutputPower
+		regs = [][2]byte{
+			{REG_PALEVEL, byte(val+18) | RF_PALEVEL_PA0_ON},
+			{REG_OCP, RF_OCP_ON},
+		}
+	} else if settings.highPower {
+		regs = [][2]byte{
+			{REG_OCP, RF_OCP_OFF},
+			{REG_PALEVEL, settings.paLevel | RF_PALEVEL_PA1_ON | RF_PALEVEL_PA2_ON},
+			{REG_TESTPA1, 0x5D},
+			{REG_TESTPA2, 0x7C},
+		}
 	} else if settings.pa2 {
-		r.writeReg(REG_TESTPA1, 0x55)
-		r.writeReg(REG_TESTPA2, 0x70)
-		r.writeReg(REG_PALEVEL, settings.paLevel|RF_PALEVEL_PA1_ON|RF_PALEVEL_PA2_ON)
-		r.writeReg(REG_OCP, RF_OCP_ON)
+		regs = [][2]byte{
+			{REG_TESTPA1, 0x55},
+			{REG_TESTPA2, 0x70},
+			{REG_PALEVEL, settings.paLevel | RF_PALEVEL_PA1_ON | RF_PALEVEL_PA2_ON},
+			{REG_OCP, RF_OCP_ON},
+		}
 	} else {
-		r.writeReg(REG_TESTPA1, 0x55)
-		r.writeReg(REG_TESTPA2, 0x70)
-		r.writeReg(REG_PALEVEL, settings.paLevel|RF_PALEVEL_PA1_ON)
-		r.writeReg(REG_OCP, RF_OCP_ON)
+		regs = [][2]byte{
+			{REG_TESTPA1, 0x55},
+			{REG_TESTPA2, 0x70},
+			{REG_PALEVEL, settings.paLevel | RF_PALEVEL_PA1_ON},
+			{REG_OCP, RF_OCP_ON},
+		}
 	}
+
+	for _, kv := range regs {
+		if err := r.writeReg(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (r *Radio) clearFIFO() {
-	//r.writeReg(0x28, 0x10);
-	r.writeReg(REG_IRQFLAGS2, RF_IRQFLAGS2_FIFOOVERRUN)
+func (r *Radio) SetEncryptionKey(key []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setEncryptionKey(key)
+}
+
+func (r *Radio) setEncryptionKey(key []byte) error {
+	if key != nil && len(key) != 16 {
+		return fmt.Errorf("aes key must be 16 bytes, got %d", len(key))
+	}
+
+	if err := r.setMode(ModeStandby); err != nil {
+		return errors.Wrap(err, "set standby")
+	}
+
+	aes := byte(RF_PACKET2_AES_OFF)
+	if key != nil {
+		tx := append([]byte{REG_AESKEY1 | 0x80}, key...)
+		if err := r.board.TxSPI(tx, nil); err != nil {
+			return errors.Wrap(err, "write aes key")
+		}
+		aes = RF_PACKET2_AES_ON
+	}
+
+	if err := r.editReg(REG_PACKETCONFIG2, func(val byte) byte {
+		return val&0xFE | aes
+	}); err != nil {
+		return errors.Wrap(err, "set aes")
+	}
+
+	if val, ok := r.regs[REG_PACKETCONFIG2]; ok {
+		r.regs[REG_PACKETCONFIG2] = val&0xFE | aes
+	}
+	r.aesKey = key
+
+	return nil
 }
 
-func (r *Radio) waitForPacketSent() {
-	for r.readReg(REG_IRQFLAGS2)&RF_IRQFLAGS2_PACKETSENT == 0x00 {
+// volatileRegs are changed during normal operation and are skipped, or
+// masked, when comparing the chip against the applied config.
+var volatileRegs = map[byte]byte{
+	REG_FIFO:          0x00,
+	REG_OPMODE:        0x00,
+	REG_DIOMAPPING1:   0x00,
+	REG_IRQFLAGS1:     0x00,
+	REG_IRQFLAGS2:     0x00,
+	REG_PACKETCONFIG2: ^byte(RF_PACKET2_RXRESTART),
+	255:               0x00,
+}
+
+func (r *Radio) VerifyConfig() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.verifyConfig()
+}
+
+func (r *Radio) verifyConfig() error {
+	for _, kv := range r.config {
+		mask := byte(0xFF)
+		if m, ok := volatileRegs[kv[0]]; ok {
+			mask = m
+		}
+		if mask == 0 {
+			continue
+		}
+
+		want := r.regs[kv[0]]
+		got, err := r.readReg(kv[0])
+		if err != nil {
+			return err
+		}
+		if got&mask != want&mask {
+			return errors.Wrapf(
+				ErrConfigMismatch,
+				"%s: wrote 0x%02x, read 0x%02x",
+				RegisterName(kv[0]), want, got,
+			)
+		}
 	}
+
+	return nil
+}
+
+func (r *Radio) clearFIFO() error {
+	//r.writeReg(0x28, 0x10);
+	return r.writeReg(REG_IRQFLAGS2, RF_IRQFLAGS2_FIFOOVERRUN)
+}
+
+func (r *Radio) waitForPacketSent(msgLen int) error {
+	timeout := r.airtime(msgLen)*time.Duration(r.timeouts.AirtimeFactor) + r.timeouts.PacketSentMargin
+	return r.waitForFlag(REG_IRQFLAGS2, RF_IRQFLAGS2_PACKETSENT, timeout)
 }
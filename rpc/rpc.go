@@ -0,0 +1,285 @@
+// Package rpc matches requests to replies over the radio, or over a layer
+// such as secure or mesh. Frames start with a three byte header:
+//
+//	request   rfm69.ProtoRPCRequest, call ID, method, then the request
+//	response  rfm69.ProtoRPCResponse, call ID, status, then the reply, or
+//	          an error message
+//
+// Call IDs are per caller, so a reply is matched by its source address and
+// ID. A request resent after a lost ack is handled again, unless the
+// radio has sequence numbers turned on, which drops the duplicate.
+// A request arriving while eight others are being handled is dropped, and
+// its caller times out.
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+const (
+	kindRequest  = rfm69.ProtoRPCRequest
+	kindResponse = rfm69.ProtoRPCResponse
+
+	headerLen = 3
+
+	// maxServing bounds the requests handled at once.
+	maxServing = 8
+
+	// maxErrorLen is where error messages are cut off, leaving them room
+	// under any layer.
+	maxErrorLen = 32
+)
+
+type Method byte
+
+type Status byte
+
+const (
+	StatusOK Status = iota
+	StatusNoMethod
+	StatusError
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusNoMethod:
+		return "no such method"
+	case StatusError:
+		return "error"
+	default:
+		return fmt.Sprintf("Status(%d)", byte(s))
+	}
+}
+
+var ErrTooManyCalls = errors.New("too many outstanding calls")
+
+// RemoteError is a failure reported by the callee.
+type RemoteError struct {
+	Status  Status
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message == "" {
+		return e.Status.String()
+	}
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// Handler answers a request from src.
+type Handler func(ctx context.Context, src byte, req []byte) ([]byte, error)
+
+// Transport is a Radio, or a layer with the same methods.
+type Transport interface {
+	SendFrame(dst byte, msg []byte) error
+	RxContext(ctx context.Context, out chan<- *rfm69.Packet) error
+}
+
+type acker interface {
+	SendWithRetry(dst byte, msg []byte, retries int, timeout time.Duration) error
+}
+
+type Endpoint struct {
+	t Transport
+
+	ackRetries int
+	ackTimeout time.Duration
+	acks       bool
+
+	serving chan struct{}
+
+	mu       sync.Mutex
+	handlers map[Method]Handler
+	calls    map[callKey]chan *rfm69.Packet
+	nextID   byte
+}
+
+type callKey struct {
+	peer byte
+	id   byte
+}
+
+type Option func(e *Endpoint)
+
+// WithAcks sends requests and responses with SendWithRetry, if the
+// transport has it.
+func WithAcks(retries int, timeout time.Duration) Option {
+	return func(e *Endpoint) {
+		e.acks = true
+		e.ackRetries = retries
+		e.ackTimeout = timeout
+	}
+}
+
+func New(t Transport, opts ...Option) *Endpoint {
+	e := &Endpoint{
+		t:        t,
+		serving:  make(chan struct{}, maxServing),
+		handlers: map[Method]Handler{},
+		calls:    map[callKey]chan *rfm69.Packet{},
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Handle serves method with h, replacing any handler already set.
+func (e *Endpoint) Handle(method Method, h Handler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.handlers[method] = h
+}
+
+// Call sends req to dst and waits for the reply until ctx is done. Any
+// number of calls may be outstanding. Without acks, a request or reply
+// lost on air only shows as ctx expiring. RxContext must be running.
+func (e *Endpoint) Call(ctx context.Context, dst byte, method Method, req []byte) ([]byte, error) {
+	id, ch, err := e.register(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer e.unregister(dst, id)
+
+	msg := append([]byte{kindRequest, id, byte(method)}, req...)
+	if err := e.send(dst, msg); err != nil {
+		return nil, errors.Wrap(err, "send request")
+	}
+
+	select {
+	case p := <-ch:
+		status, body := Status(p.Payload[2]), p.Payload[headerLen:]
+		if status != StatusOK {
+			return nil, &RemoteError{Status: status, Message: string(body)}
+		}
+		return body, nil
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "call 0x%02x method %d", dst, method)
+	}
+}
+
+// RxContext runs the transport's receiver, serving requests and
+// delivering replies. Other frames are sent to out.
+func (e *Endpoint) RxContext(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- e.t.RxContext(ctx, in) }()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case p := <-in:
+			if len(p.Payload) >= headerLen {
+				switch p.Payload[0] {
+				case kindRequest:
+					select {
+					case e.serving <- struct{}{}:
+						go e.serve(ctx, p)
+					default:
+						// busy; the caller times out or retries
+					}
+					continue
+				case kindResponse:
+					e.deliver(p)
+					continue
+				}
+			}
+
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (e *Endpoint) serve(ctx context.Context, p *rfm69.Packet) {
+	defer func() { <-e.serving }()
+
+	id, method := p.Payload[1], Method(p.Payload[2])
+
+	e.mu.Lock()
+	h := e.handlers[method]
+	e.mu.Unlock()
+
+	status := StatusOK
+	var body []byte
+	if h == nil {
+		status = StatusNoMethod
+	} else if resp, err := h(ctx, p.Src, p.Payload[headerLen:]); err != nil {
+		status, body = StatusError, []byte(err.Error())
+		if len(body) > maxErrorLen {
+			body = body[:maxErrorLen]
+		}
+	} else {
+		body = resp
+	}
+
+	msg := append([]byte{kindResponse, id, byte(status)}, body...)
+
+	// the caller times out if this fails
+	_ = e.send(p.Src, msg)
+}
+
+func (e *Endpoint) deliver(p *rfm69.Packet) {
+	e.mu.Lock()
+	ch := e.calls[callKey{p.Src, p.Payload[1]}]
+	e.mu.Unlock()
+
+	if ch == nil {
+		return // late, or not ours
+	}
+	select {
+	case ch <- p:
+	default:
+	}
+}
+
+func (e *Endpoint) send(dst byte, msg []byte) error {
+	if a, ok := e.t.(acker); ok && e.acks {
+		return a.SendWithRetry(dst, msg, e.ackRetries, e.ackTimeout)
+	}
+	return e.t.SendFrame(dst, msg)
+}
+
+func (e *Endpoint) register(dst byte) (byte, chan *rfm69.Packet, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := 0; i < 256; i++ {
+		id := e.nextID
+		e.nextID++
+
+		key := callKey{dst, id}
+		if _, busy := e.calls[key]; busy {
+			continue
+		}
+
+		ch := make(chan *rfm69.Packet, 1)
+		e.calls[key] = ch
+		return id, ch, nil
+	}
+
+	return 0, nil, errors.Wrapf(ErrTooManyCalls, "to 0x%02x", dst)
+}
+
+func (e *Endpoint) unregister(dst, id byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.calls, callKey{dst, id})
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+)
+
+const (
+	methodEcho Method = iota + 1
+	methodFail
+	methodSlow
+)
+
+func newEndpoints(t *testing.T, opts ...Option) (*Endpoint, *Endpoint) {
+	t.Helper()
+
+	m := sim.NewMedium()
+	var eps []*Endpoint
+	for addr := byte(1); addr <= 2; addr++ {
+		r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(addr), rfm69.WithSequenceNumbers())
+		if err := r.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		eps = append(eps, New(r, opts...))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	for _, e := range eps {
+		e := e
+		go func() { _ = e.RxContext(ctx, make(chan *rfm69.Packet, 8)) }()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	server := eps[1]
+	// the first byte of the request is how many 30ms to wait
+	server.Handle(methodEcho, func(ctx context.Context, src byte, req []byte) ([]byte, error) {
+		time.Sleep(time.Duration(req[0]) * 30 * time.Millisecond)
+		return append([]byte(fmt.Sprintf("%d:", src)), req[1:]...), nil
+	})
+	server.Handle(methodFail, func(ctx context.Context, src byte, req []byte) ([]byte, error) {
+		return nil, errors.New("config locked")
+	})
+	server.Handle(methodSlow, func(ctx context.Context, src byte, req []byte) ([]byte, error) {
+		time.Sleep(500 * time.Millisecond)
+		return nil, nil
+	})
+
+	return eps[0], server
+}
+
+func TestCall(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"acked", []Option{WithAcks(3, 100*time.Millisecond)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, _ := newEndpoints(t, tc.opts...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			// outstanding calls are answered in reverse order
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					req := fmt.Sprintf("req %d", i)
+					resp, err := client.Call(ctx, 2, methodEcho, append([]byte{byte(5 - i)}, req...))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if want := "1:" + req; string(resp) != want {
+						t.Errorf("got %q, want %q", resp, want)
+					}
+				}(i)
+				time.Sleep(10 * time.Millisecond)
+			}
+			wg.Wait()
+
+			var remote *RemoteError
+			_, err := client.Call(ctx, 2, methodFail, nil)
+			if !errors.As(err, &remote) || remote.Status != StatusError || remote.Message != "config locked" {
+				t.Errorf("failing method: %v", err)
+			}
+
+			_, err = client.Call(ctx, 2, 99, nil)
+			if !errors.As(err, &remote) || remote.Status != StatusNoMethod {
+				t.Errorf("unknown method: %v", err)
+			}
+		})
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	client, _ := newEndpoints(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.Call(ctx, 2, methodSlow, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow call: %v", err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.calls) != 0 {
+		t.Errorf("%d calls left outstanding", len(client.calls))
+	}
+}
+
+func TestServingBounded(t *testing.T) {
+	client, server := newEndpoints(t)
+
+	var mu sync.Mutex
+	var running, peak int
+	const methodCount Method = 10
+	server.Handle(methodCount, func(ctx context.Context, src byte, req []byte) ([]byte, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(300 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2*maxServing; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.Call(ctx, 2, methodCount, nil)
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if peak != maxServing {
+		t.Errorf("%d requests handled at once, want %d", peak, maxServing)
+	}
+}
@@ -0,0 +1,159 @@
+package secure
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// ccm is AES-CCM (RFC 3610) with a 2 byte length field, so a 13 byte
+// nonce, and a tag of tagSize bytes.
+type ccm struct {
+	block   cipher.Block
+	tagSize int
+}
+
+const (
+	ccmL         = 2
+	ccmNonceSize = 15 - ccmL
+)
+
+var errOpen = errors.New("message authentication failed")
+
+func newCCM(block cipher.Block, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("ccm needs a 128 bit block cipher")
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+		return nil, errors.New("bad ccm tag size")
+	}
+	return &ccm{block: block, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int { return ccmNonceSize }
+func (c *ccm) Overhead() int  { return c.tagSize }
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != ccmNonceSize {
+		panic("ccm: bad nonce length")
+	}
+	if len(plaintext) >= 1<<(8*ccmL) {
+		panic("ccm: message too long")
+	}
+
+	tag := c.mac(nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	c.ctr(nonce, out, plaintext)
+
+	s0 := c.counterBlock(nonce, 0)
+	for i := 0; i < c.tagSize; i++ {
+		out[len(plaintext)+i] = tag[i] ^ s0[i]
+	}
+	return ret
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != ccmNonceSize {
+		panic("ccm: bad nonce length")
+	}
+	if len(ciphertext) < c.tagSize {
+		return nil, errOpen
+	}
+
+	n := len(ciphertext) - c.tagSize
+	ret, out := sliceForAppend(dst, n)
+	c.ctr(nonce, out, ciphertext[:n])
+
+	s0 := c.counterBlock(nonce, 0)
+	want := c.mac(nonce, out, additionalData)
+	got := make([]byte, c.tagSize)
+	for i := range got {
+		got[i] = ciphertext[n+i] ^ s0[i]
+	}
+
+	if subtle.ConstantTimeCompare(got, want[:c.tagSize]) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// mac computes the CBC-MAC over B0, the encoded additional data and the
+// message.
+func (c *ccm) mac(nonce, msg, aad []byte) []byte {
+	var b0 [16]byte
+	flags := byte((c.tagSize-2)/2)<<3 | (ccmL - 1)
+	if len(aad) > 0 {
+		flags |= 0x40
+	}
+	b0[0] = flags
+	copy(b0[1:], nonce)
+	binary.BigEndian.PutUint16(b0[14:], uint16(len(msg)))
+
+	x := make([]byte, 16)
+	c.block.Encrypt(x, b0[:])
+
+	if len(aad) > 0 {
+		if len(aad) >= 0xFF00 {
+			panic("ccm: additional data too long")
+		}
+		buf := binary.BigEndian.AppendUint16(nil, uint16(len(aad)))
+		buf = append(buf, aad...)
+		c.cbc(x, buf)
+	}
+	c.cbc(x, msg)
+
+	return x
+}
+
+// cbc folds data, zero padded to whole blocks, into the MAC state x.
+func (c *ccm) cbc(x, data []byte) {
+	for len(data) > 0 {
+		n := min(16, len(data))
+		for i := 0; i < n; i++ {
+			x[i] ^= data[i]
+		}
+		c.block.Encrypt(x, x)
+		data = data[n:]
+	}
+}
+
+func (c *ccm) counterBlock(nonce []byte, i uint16) []byte {
+	var a [16]byte
+	a[0] = ccmL - 1
+	copy(a[1:], nonce)
+	binary.BigEndian.PutUint16(a[14:], i)
+
+	s := make([]byte, 16)
+	c.block.Encrypt(s, a[:])
+	return s
+}
+
+// ctr encrypts or decrypts src into dst with counter blocks from 1.
+func (c *ccm) ctr(nonce, dst, src []byte) {
+	for i := 0; len(src) > 0; i++ {
+		s := c.counterBlock(nonce, uint16(i+1))
+		n := min(16, len(src))
+		for j := 0; j < n; j++ {
+			dst[j] = src[j] ^ s[j]
+		}
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// new tail.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,45 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// TestCCMVector checks packet vector #1 from RFC 3610.
+func TestCCMVector(t *testing.T) {
+	block, _ := aes.NewCipher(unhex("c0c1c2c3c4c5c6c7c8c9cacbcccdcecf"))
+	aead, err := newCCM(block, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := unhex("00000003020100a0a1a2a3a4a5")
+	aad := unhex("0001020304050607")
+	msg := unhex("08090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+	want := unhex("588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0")
+
+	got := aead.Seal(nil, nonce, msg, aad)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("seal = %x\nwant   %x", got, want)
+	}
+
+	plain, err := aead.Open(nil, nonce, got, aad)
+	if err != nil || !bytes.Equal(plain, msg) {
+		t.Fatalf("open = %x, %v", plain, err)
+	}
+
+	got[3] ^= 1
+	if _, err := aead.Open(nil, nonce, got, aad); err == nil {
+		t.Error("opened a tampered message")
+	}
+}
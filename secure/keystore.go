@@ -0,0 +1,159 @@
+package secure
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// KeySet is the key material a Layer persists.
+type KeySet struct {
+	// Epoch is the epoch frames are sent with.
+	Epoch byte `json:"epoch"`
+
+	// Network holds the network keys still accepted, by epoch.
+	Network map[byte][]byte `json:"network"`
+
+	// Peers holds the keys agreed when pairing: on a gateway, one per
+	// node, and on a node, the one shared with its gateway.
+	Peers map[byte][]byte `json:"peers,omitempty"`
+
+	// Paired is set on a node that has paired, with Gateway.
+	Paired  bool `json:"paired,omitempty"`
+	Gateway byte `json:"gateway,omitempty"`
+}
+
+// Keystore persists a Layer's keys. LoadKeys returns an empty KeySet if
+// nothing has been stored yet.
+type Keystore interface {
+	LoadKeys() (*KeySet, error)
+	SaveKeys(ks *KeySet) error
+}
+
+// MemoryKeystore is a Keystore that forgets everything on restart.
+type MemoryKeystore struct {
+	mu   sync.Mutex
+	keys []byte
+}
+
+func (m *MemoryKeystore) LoadKeys() (*KeySet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return decodeKeySet(m.keys)
+}
+
+func (m *MemoryKeystore) SaveKeys(ks *KeySet) error {
+	buf, err := json.Marshal(ks)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = buf
+	return nil
+}
+
+// FileKeystore keeps keys as JSON in the named file, readable only by its
+// owner.
+type FileKeystore string
+
+func (f FileKeystore) LoadKeys() (*KeySet, error) {
+	buf, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return &KeySet{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read keystore")
+	}
+	return decodeKeySet(buf)
+}
+
+func (f FileKeystore) SaveKeys(ks *KeySet) error {
+	buf, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	return errors.Wrap(writeFile(string(f), buf), "save keystore")
+}
+
+// FileCounters is a CounterStore keeping counters as JSON in the named
+// file.
+type FileCounters string
+
+func (f FileCounters) LoadCounter(name string) (uint32, error) {
+	vals, err := f.load()
+	if err != nil {
+		return 0, err
+	}
+	return vals[name], nil
+}
+
+func (f FileCounters) StoreCounter(name string, val uint32) error {
+	vals, err := f.load()
+	if err != nil {
+		return err
+	}
+	vals[name] = val
+
+	buf, err := json.Marshal(vals)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+	return writeFile(string(f), buf)
+}
+
+func (f FileCounters) load() (map[string]uint32, error) {
+	vals := map[string]uint32{}
+
+	buf, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return vals, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read counters")
+	}
+	if err := json.Unmarshal(buf, &vals); err != nil {
+		return nil, errors.Wrap(err, "decode counters")
+	}
+	return vals, nil
+}
+
+// writeFile replaces name with buf, so a crash leaves either the old
+// contents or the new.
+func writeFile(name string, buf []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".secure-*")
+	if err != nil {
+		return errors.Wrap(err, "create")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "sync")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "write")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), name), "replace")
+}
+
+func decodeKeySet(buf []byte) (*KeySet, error) {
+	ks := &KeySet{}
+	if len(buf) == 0 {
+		return ks, nil
+	}
+	if err := json.Unmarshal(buf, ks); err != nil {
+		return nil, errors.Wrap(err, "decode keystore")
+	}
+	return ks, nil
+}
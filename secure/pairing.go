@@ -0,0 +1,421 @@
+package secure
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+// Key management messages go out as plain radio frames marked by the
+// reserved epoch, followed by a message type:
+//
+//	pair request   ff 'P' node public key (32)
+//	pair response  ff 'R' gateway public key (32), sealed epoch and network key
+//	rekey          ff 'K' epoch, counter (4), sealed network key
+//
+// Pairing is an unauthenticated X25519 exchange, so it is done at low
+// power and only while the gateway is accepting. Both ends derive a peer
+// key from the shared secret; the gateway uses it to hand over the current
+// network key, and later to deliver rotated ones. Rekeys draw their
+// counter from the gateway's frame counter, so the usual replay check
+// applies to them too.
+const (
+	controlEpoch = 0xFF
+
+	msgPairRequest  = 'P'
+	msgPairResponse = 'R'
+	msgRekey        = 'K'
+
+	distributedKeyLen = 16
+
+	controlRetries = 3
+	controlTimeout = 250 * time.Millisecond
+)
+
+var ErrNotPaired = errors.New("not paired with a gateway")
+
+// AcceptPairing puts the gateway in pairing mode until one node has
+// paired, returning its address, or ctx is done.
+func (l *Layer) AcceptPairing(ctx context.Context) (byte, error) {
+	l.mu.Lock()
+	netKey, epoch := l.raw[l.epoch], l.epoch
+	l.mu.Unlock()
+
+	if len(netKey) != distributedKeyLen {
+		return 0, errors.Errorf("network key must be %d bytes to distribute", distributedKeyLen)
+	}
+
+	requests, done := l.await(msgPairRequest)
+	defer done()
+
+	defer l.pairingPower()()
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return 0, errors.Wrap(err, "generate key")
+	}
+	gwPub := priv.PublicKey().Bytes()
+
+	// anyone can send a request, so bad ones are logged and skipped
+	var (
+		p       *rfm69.Packet
+		peerKey []byte
+	)
+	for peerKey == nil {
+		select {
+		case p = <-requests:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		if len(p.Payload) != 2+32 {
+			l.log.Warn("bad pair request", "src", p.Src, "len", len(p.Payload))
+			continue
+		}
+		nodePub := p.Payload[2:]
+		if peerKey, err = agree(priv, nodePub, nodePub, gwPub); err != nil {
+			l.log.Warn("bad pair request", "src", p.Src, "err", err)
+		}
+	}
+
+	aead, err := newAEAD(peerKey)
+	if err != nil {
+		return 0, err
+	}
+
+	hdr := append([]byte{controlEpoch, msgPairResponse}, gwPub...)
+	msg := aead.Seal(hdr, controlNonce(msgPairResponse, p.Src, 0), append([]byte{epoch}, netKey...), aad(l.addr, p.Src, hdr))
+
+	if err := l.radio.SendWithRetry(p.Src, msg, controlRetries, controlTimeout); err != nil {
+		return 0, errors.Wrap(err, "send pair response")
+	}
+
+	l.mu.Lock()
+	l.peers[p.Src] = peerKey
+	l.mu.Unlock()
+
+	return p.Src, l.saveKeys()
+}
+
+// Pair asks gateway, which must be accepting pairings, for the network
+// key. Rx must be running.
+func (l *Layer) Pair(ctx context.Context, gateway byte) error {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "generate key")
+	}
+	nodePub := priv.PublicKey().Bytes()
+
+	responses, done := l.await(msgPairResponse)
+	defer done()
+
+	defer l.pairingPower()()
+
+	req := append([]byte{controlEpoch, msgPairRequest}, nodePub...)
+	if err := l.radio.SendWithRetry(gateway, req, controlRetries, controlTimeout); err != nil {
+		return errors.Wrap(err, "send pair request")
+	}
+
+	for {
+		var p *rfm69.Packet
+		select {
+		case p = <-responses:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if p.Src != gateway || len(p.Payload) < 2+32 {
+			continue
+		}
+
+		hdr, sealed := p.Payload[:2+32], p.Payload[2+32:]
+		peerKey, err := agree(priv, hdr[2:], nodePub, hdr[2:])
+		if err != nil {
+			return err
+		}
+		aead, err := newAEAD(peerKey)
+		if err != nil {
+			return err
+		}
+
+		plain, err := aead.Open(nil, controlNonce(msgPairResponse, l.addr, 0), sealed, aad(p.Src, p.Dst, hdr))
+		if err != nil || len(plain) != 1+distributedKeyLen {
+			return errors.Wrap(ErrAuth, "pair response")
+		}
+
+		l.mu.Lock()
+		err = l.addKey(plain[0], plain[1:])
+		if err == nil {
+			l.epoch = plain[0]
+			l.peers = map[byte][]byte{gateway: peerKey}
+			l.paired, l.gateway = true, gateway
+		}
+		l.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+		return l.saveKeys()
+	}
+}
+
+// Rotate moves to a fresh network key under the next epoch, delivering it
+// to every paired node first. The previous key is still accepted for the
+// grace period. Nodes that didn't ack are reported in the error and must
+// pair again once the grace period is over.
+func (l *Layer) Rotate() error {
+	key := make([]byte, distributedKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return errors.Wrap(err, "generate key")
+	}
+
+	l.mu.Lock()
+	prev := l.epoch
+	epoch := prev + 1
+	if epoch == controlEpoch {
+		epoch = 0
+	}
+	err := l.addKey(epoch, key)
+	nodes := make([]byte, 0, len(l.peers))
+	for addr := range l.peers {
+		nodes = append(nodes, addr)
+	}
+	l.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	var missed []byte
+	for _, node := range nodes {
+		msg, err := l.rekeyMsg(node, epoch, key)
+		if err != nil {
+			return err
+		}
+		if err := l.radio.SendWithRetry(node, msg, controlRetries, controlTimeout); err != nil {
+			missed = append(missed, node)
+		}
+	}
+
+	l.mu.Lock()
+	l.epoch = epoch
+	l.mu.Unlock()
+	l.retire(prev)
+
+	if err := l.saveKeys(); err != nil {
+		return err
+	}
+	if len(missed) > 0 {
+		return errors.Errorf("rekey to epoch %d not acked by %v", epoch, missed)
+	}
+	return nil
+}
+
+func (l *Layer) rekeyMsg(node, epoch byte, key []byte) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	aead, err := newAEAD(l.peers[node])
+	if err != nil {
+		return nil, err
+	}
+	counter, err := l.nextCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := []byte{controlEpoch, msgRekey, epoch, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hdr[3:], counter)
+	return aead.Seal(hdr, controlNonce(msgRekey, node, counter), key, aad(l.addr, node, hdr)), nil
+}
+
+func (l *Layer) handleRekey(p *rfm69.Packet) error {
+	if len(p.Payload) < 7+tagSize {
+		return ErrAuth
+	}
+	hdr := p.Payload[:7]
+	epoch, counter := hdr[2], binary.BigEndian.Uint32(hdr[3:])
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.paired || p.Src != l.gateway {
+		return ErrNotPaired
+	}
+	aead, err := newAEAD(l.peers[p.Src])
+	if err != nil {
+		return err
+	}
+
+	key, err := aead.Open(nil, controlNonce(msgRekey, l.addr, counter), p.Payload[7:], aad(p.Src, p.Dst, hdr))
+	if err != nil {
+		l.stats.BadAuth++
+		return ErrAuth
+	}
+	if err := l.accept(p.Src, counter); err != nil {
+		return err
+	}
+
+	if err := l.addKey(epoch, key); err != nil {
+		return err
+	}
+	if prev := l.epoch; prev != epoch {
+		l.epoch = epoch
+		l.retireLocked(prev)
+	}
+	return nil
+}
+
+// retire drops epoch's key once the grace period is over, unless it has
+// become current again.
+func (l *Layer) retire(epoch byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retireLocked(epoch)
+}
+
+func (l *Layer) retireLocked(epoch byte) {
+	time.AfterFunc(l.grace, func() {
+		l.mu.Lock()
+		if l.epoch == epoch {
+			l.mu.Unlock()
+			return
+		}
+		delete(l.keys, epoch)
+		delete(l.raw, epoch)
+		l.mu.Unlock()
+
+		if err := l.saveKeys(); err != nil {
+			l.log.Warn("save keys failed", "err", err)
+		}
+	})
+}
+
+func isControl(p *rfm69.Packet) bool {
+	return len(p.Payload) >= 2 && p.Payload[0] == controlEpoch
+}
+
+func (l *Layer) handleControl(p *rfm69.Packet) {
+	if p.Payload[1] == msgRekey {
+		if err := l.handleRekey(p); err != nil {
+			l.log.Warn("rekey rejected", "src", p.Src, "err", err)
+			return
+		}
+		if err := l.saveKeys(); err != nil {
+			l.log.Warn("save keys failed", "err", err)
+		}
+		return
+	}
+
+	l.mu.Lock()
+	ch := l.waiting[p.Payload[1]]
+	l.mu.Unlock()
+
+	if ch != nil {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// await routes control messages of type typ to the returned channel until
+// done is called.
+func (l *Layer) await(typ byte) (<-chan *rfm69.Packet, func()) {
+	ch := make(chan *rfm69.Packet, 1)
+
+	l.mu.Lock()
+	l.waiting[typ] = ch
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.waiting[typ] == ch {
+			delete(l.waiting, typ)
+		}
+	}
+}
+
+// pairingPower caps the radio's power, ATPC's levels included, for the
+// duration of a pairing.
+func (l *Layer) pairingPower() func() {
+	dBm, _ := l.radio.Variant().PowerRange()
+	if l.pairPower != nil {
+		dBm = *l.pairPower
+	}
+	return l.radio.LimitPower(dBm)
+}
+
+func (l *Layer) saveKeys() error {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	l.mu.Lock()
+	ks := &KeySet{
+		Epoch:   l.epoch,
+		Network: make(map[byte][]byte, len(l.raw)),
+		Peers:   make(map[byte][]byte, len(l.peers)),
+		Paired:  l.paired,
+		Gateway: l.gateway,
+	}
+	for epoch, k := range l.raw {
+		ks.Network[epoch] = k
+	}
+	for addr, k := range l.peers {
+		ks.Peers[addr] = k
+	}
+	l.mu.Unlock()
+
+	return errors.Wrap(l.keystore.SaveKeys(ks), "save keys")
+}
+
+// agree derives the peer key from an X25519 exchange, salted with both
+// public keys.
+func agree(priv *ecdh.PrivateKey, peerPub, nodePub, gwPub []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(peerPub)
+	if err != nil {
+		return nil, errors.Wrap(err, "peer key")
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "ecdh")
+	}
+
+	salt := append(append([]byte(nil), nodePub...), gwPub...)
+	return hkdf(shared, salt, []byte("rfm69 pairing"), distributedKeyLen), nil
+}
+
+// hkdf is HKDF-SHA256 (RFC 5869).
+func hkdf(secret, salt, info []byte, n int) []byte {
+	ext := hmac.New(sha256.New, salt)
+	ext.Write(secret)
+	prk := ext.Sum(nil)
+
+	var out, t []byte
+	for i := byte(1); len(out) < n; i++ {
+		exp := hmac.New(sha256.New, prk)
+		exp.Write(t)
+		exp.Write(info)
+		exp.Write([]byte{i})
+		t = exp.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:n]
+}
+
+func controlNonce(typ, dst byte, counter uint32) []byte {
+	n := make([]byte, ccmNonceSize)
+	n[0] = controlEpoch
+	n[1] = typ
+	n[2] = dst
+	binary.BigEndian.PutUint32(n[3:], counter)
+	return n
+}
@@ -0,0 +1,198 @@
+package secure
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+)
+
+func TestHKDF(t *testing.T) {
+	// RFC 5869 test case 1
+	ikm := make([]byte, 22)
+	for i := range ikm {
+		ikm[i] = 0x0b
+	}
+	salt := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c}
+	info := []byte{0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8, 0xf9}
+
+	got := hkdf(ikm, salt, info, 42)
+	want := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("okm = %s", hex.EncodeToString(got))
+	}
+}
+
+func TestPairAndRotate(t *testing.T) {
+	m := sim.NewMedium()
+
+	gwRadio := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(1))
+	if err := gwRadio.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	gw, err := New(gwRadio, key, WithGracePeriod(200*time.Millisecond), WithCounterStore(&MemoryCounters{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := FileKeystore(filepath.Join(t.TempDir(), "keys.json"))
+	counters := &MemoryCounters{}
+	nodeRadio := newRadio(t, m, 2)
+	node, err := New(nodeRadio, nil, WithKeystore(ks), WithGracePeriod(200*time.Millisecond), WithCounterStore(counters))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gwRx := make(chan *rfm69.Packet, 8)
+	go func() { _ = gw.RxContext(ctx, gwRx) }()
+	go func() { _ = node.RxContext(ctx, make(chan *rfm69.Packet, 8)) }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := node.SendFrame(1, []byte("hello")); err == nil {
+		t.Fatal("sent before pairing")
+	}
+
+	paired := make(chan byte, 1)
+	go func() {
+		pctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		addr, err := gw.AcceptPairing(pctx)
+		if err != nil {
+			t.Error(err)
+		}
+		paired <- addr
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// malformed requests, one short and one with a low order key, don't
+	// end pairing mode
+	stray := newRadio(t, m, 3)
+	for _, req := range [][]byte{
+		{controlEpoch, msgPairRequest, 1, 2, 3},
+		append([]byte{controlEpoch, msgPairRequest}, make([]byte, 32)...),
+	} {
+		if err := stray.SendFrame(1, req); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := node.Pair(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if addr := <-paired; addr != 2 {
+		t.Errorf("paired with 0x%02x", addr)
+	}
+	if p := gwRadio.TxPower(); p != 13 {
+		t.Errorf("gateway left at %d dBm", p)
+	}
+
+	if err := node.SendFrame(1, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, gwRx, "hello")
+
+	stale, err := node.seal(1, []byte("stale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for node.Epoch() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("node never rekeyed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// the old key is still good during the grace period
+	if err := nodeRadio.SendFrame(1, stale); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, gwRx, "stale")
+
+	if err := node.SendFrame(1, []byte("rotated")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, gwRx, "rotated")
+
+	time.Sleep(400 * time.Millisecond)
+	for _, l := range []*Layer{gw, node} {
+		l.mu.Lock()
+		_, ok := l.keys[0]
+		l.mu.Unlock()
+		if ok {
+			t.Errorf("0x%02x still accepts epoch 0", l.addr)
+		}
+	}
+
+	stored, err := ks.LoadKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Epoch != 1 || len(stored.Network) != 1 || stored.Gateway != 1 || len(stored.Peers[1]) != distributedKeyLen {
+		t.Errorf("stored keys = %+v", stored)
+	}
+
+	restarted, err := New(nodeRadio, nil, WithKeystore(ks), WithCounterStore(counters))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Epoch() != 1 || restarted.gateway != 1 {
+		t.Errorf("restarted at epoch %d, gateway 0x%02x", restarted.Epoch(), restarted.gateway)
+	}
+}
+
+func TestPairingOutOfRange(t *testing.T) {
+	for _, atpc := range []bool{false, true} {
+		t.Run(fmt.Sprintf("atpc=%v", atpc), func(t *testing.T) {
+			m := sim.NewMedium()
+
+			// ATPC would start each peer at full power
+			opts := []rfm69.Option{rfm69.WithTxPower(20)}
+			if atpc {
+				opts = append(opts, rfm69.WithATPC(-60))
+			}
+
+			gb := m.NewBoard()
+			gwRadio := rfm69.NewRadio(gb, append(opts, rfm69.WithAddress(1))...)
+			if err := gwRadio.Setup(); err != nil {
+				t.Fatal(err)
+			}
+			gw, _ := New(gwRadio, key, WithCounterStore(&MemoryCounters{}))
+
+			nb := m.NewBoard()
+			nodeRadio := rfm69.NewRadio(nb, append(opts, rfm69.WithAddress(2))...)
+			if err := nodeRadio.Setup(); err != nil {
+				t.Fatal(err)
+			}
+			node, _ := New(nodeRadio, nil, WithCounterStore(&MemoryCounters{}))
+
+			// close enough at full power, but not at pairing power
+			m.SetPathLoss(gb, nb, 120)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			go func() { _ = gw.RxContext(ctx, make(chan *rfm69.Packet, 8)) }()
+			go func() { _ = node.RxContext(ctx, make(chan *rfm69.Packet, 8)) }()
+			go func() { _, _ = gw.AcceptPairing(ctx) }()
+			time.Sleep(10 * time.Millisecond)
+
+			if err := node.Pair(ctx, 1); err == nil {
+				t.Fatal("paired from out of range")
+			}
+		})
+	}
+}
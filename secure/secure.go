@@ -0,0 +1,460 @@
+// Package secure adds authenticated encryption and replay protection on
+// top of a Radio, which the chip's own AES (ECB, no integrity check)
+// doesn't provide.
+//
+// Each frame's payload is
+//
+//	0     key epoch
+//	1..4  sender's frame counter, big endian
+//	5..   AES-CCM ciphertext followed by an 8 byte tag
+//
+// The nonce is the sender's address, the epoch and the counter, so it
+// never repeats for a key as long as each sender's counter only goes up,
+// across restarts too, so New requires a CounterStore.
+// The frame's source and destination addresses are authenticated too.
+// Receivers remember the last counter accepted from each sender and
+// reject anything not above it. They store it every counterBlock frames,
+// so a receiver that restarts may accept that many replayed frames from
+// each sender. Acks are not authenticated.
+//
+// Nodes get the network key by pairing with a gateway, which can later
+// rotate it; keys are kept in a Keystore.
+package secure
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+const (
+	headerLen = 5
+	tagSize   = 8
+
+	// counterBlock is how far ahead the send counter is reserved in the
+	// CounterStore, and how far received counters get before they are
+	// stored, so neither is written for every frame.
+	counterBlock = 1024
+)
+
+var (
+	ErrAuth   = errors.New("frame failed authentication")
+	ErrReplay = errors.New("replayed frame")
+	ErrNoKey  = errors.New("no key for epoch")
+
+	ErrNoCounterStore = errors.New("no counter store")
+)
+
+// CounterStore persists counters across restarts. If it forgets, a node
+// that restarts reuses nonces, and a receiver that restarts accepts
+// frames it has seen before.
+type CounterStore interface {
+	LoadCounter(name string) (uint32, error)
+	StoreCounter(name string, val uint32) error
+}
+
+// MemoryCounters is a CounterStore that forgets everything on restart. It
+// is only safe when the key doesn't outlive the process.
+type MemoryCounters struct {
+	mu   sync.Mutex
+	vals map[string]uint32
+}
+
+func (m *MemoryCounters) LoadCounter(name string) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.vals[name], nil
+}
+
+func (m *MemoryCounters) StoreCounter(name string, val uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.vals == nil {
+		m.vals = map[string]uint32{}
+	}
+	m.vals[name] = val
+	return nil
+}
+
+type Stats struct {
+	Accepted uint64
+	BadAuth  uint64
+	Replayed uint64
+}
+
+type Layer struct {
+	radio     *rfm69.Radio
+	addr      byte
+	counters  CounterStore
+	keystore  Keystore
+	grace     time.Duration
+	pairPower *int
+	log       *slog.Logger
+	saveMu    sync.Mutex
+
+	mu       sync.Mutex
+	epoch    byte
+	keys     map[byte]cipher.AEAD
+	raw      map[byte][]byte
+	peers    map[byte][]byte
+	paired   bool
+	gateway  byte
+	waiting  map[byte]chan *rfm69.Packet
+	counter  uint32
+	reserved uint32
+	lastRx   map[byte]uint32
+	rxStored map[byte]uint32
+	stats    Stats
+}
+
+type Option func(l *Layer)
+
+func WithCounterStore(s CounterStore) Option {
+	return func(l *Layer) {
+		l.counters = s
+	}
+}
+
+func WithKeystore(ks Keystore) Option {
+	return func(l *Layer) {
+		l.keystore = ks
+	}
+}
+
+func WithLogger(log *slog.Logger) Option {
+	return func(l *Layer) {
+		l.log = log
+	}
+}
+
+// WithGracePeriod sets how long frames under the previous epoch's key are
+// still accepted after a rotation.
+func WithGracePeriod(d time.Duration) Option {
+	return func(l *Layer) {
+		l.grace = d
+	}
+}
+
+// WithPairingPower sets the transmit power used while pairing. The
+// default is the lowest the radio supports, so only nodes close by can
+// take part.
+func WithPairingPower(dBm int) Option {
+	return func(l *Layer) {
+		l.pairPower = &dBm
+	}
+}
+
+// New returns a layer sending with key, a 16, 24 or 32 byte AES key, as
+// epoch 0. Keys found in the keystore take precedence, and key may be nil
+// for a node that has yet to pair. WithCounterStore is required.
+func New(radio *rfm69.Radio, key []byte, opts ...Option) (*Layer, error) {
+	l := &Layer{
+		radio:    radio,
+		addr:     radio.Address(),
+		keystore: &MemoryKeystore{},
+		grace:    10 * time.Minute,
+		log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		keys:     map[byte]cipher.AEAD{},
+		raw:      map[byte][]byte{},
+		peers:    map[byte][]byte{},
+		waiting:  map[byte]chan *rfm69.Packet{},
+		lastRx:   map[byte]uint32{},
+		rxStored: map[byte]uint32{},
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.counters == nil {
+		return nil, ErrNoCounterStore
+	}
+
+	ks, err := l.keystore.LoadKeys()
+	if err != nil {
+		return nil, errors.Wrap(err, "load keys")
+	}
+
+	switch {
+	case len(ks.Network) > 0:
+		for epoch, k := range ks.Network {
+			if err := l.addKey(epoch, k); err != nil {
+				return nil, errors.Wrapf(err, "epoch %d", epoch)
+			}
+		}
+		if _, ok := l.keys[ks.Epoch]; !ok {
+			return nil, errors.Wrapf(ErrNoKey, "stored epoch %d", ks.Epoch)
+		}
+		l.epoch = ks.Epoch
+		for addr, k := range ks.Peers {
+			l.peers[addr] = k
+		}
+		l.paired, l.gateway = ks.Paired, ks.Gateway
+	case key != nil:
+		if err := l.AddKey(0, key); err != nil {
+			return nil, err
+		}
+	}
+
+	reserved, err := l.counters.LoadCounter("tx")
+	if err != nil {
+		return nil, errors.Wrap(err, "load tx counter")
+	}
+	l.counter, l.reserved = reserved, reserved
+
+	return l, nil
+}
+
+// AddKey makes key usable for epoch, for receiving.
+func (l *Layer) AddKey(epoch byte, key []byte) error {
+	l.mu.Lock()
+	err := l.addKey(epoch, key)
+	l.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return l.saveKeys()
+}
+
+func (l *Layer) addKey(epoch byte, key []byte) error {
+	if epoch == controlEpoch {
+		return errors.Errorf("epoch %d is reserved", epoch)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	l.keys[epoch] = aead
+	l.raw[epoch] = append([]byte(nil), key...)
+	return nil
+}
+
+// RemoveKey stops accepting frames under epoch's key.
+func (l *Layer) RemoveKey(epoch byte) error {
+	l.mu.Lock()
+	delete(l.keys, epoch)
+	delete(l.raw, epoch)
+	l.mu.Unlock()
+
+	return l.saveKeys()
+}
+
+// SetEpoch selects the key frames are sent with.
+func (l *Layer) SetEpoch(epoch byte) error {
+	l.mu.Lock()
+	if _, ok := l.keys[epoch]; !ok {
+		l.mu.Unlock()
+		return errors.Wrapf(ErrNoKey, "%d", epoch)
+	}
+	l.epoch = epoch
+	l.mu.Unlock()
+
+	return l.saveKeys()
+}
+
+func (l *Layer) Epoch() byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.epoch
+}
+
+func (l *Layer) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *Layer) SendFrame(dst byte, msg []byte) error {
+	frame, err := l.seal(dst, msg)
+	if err != nil {
+		return err
+	}
+	return l.radio.SendFrame(dst, frame)
+}
+
+// SendWithRetry is SendFrame with acks. Retries resend the same frame;
+// receivers ack the copies but drop them as replays.
+func (l *Layer) SendWithRetry(dst byte, msg []byte, retries int, timeout time.Duration) error {
+	frame, err := l.seal(dst, msg)
+	if err != nil {
+		return err
+	}
+	return l.radio.SendWithRetry(dst, frame, retries, timeout)
+}
+
+// RxContext runs the radio's receiver and sends authenticated frames,
+// decrypted, to out. Everything else is dropped.
+func (l *Layer) RxContext(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- l.radio.RxContext(ctx, in) }()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case p := <-in:
+			if isControl(p) {
+				l.handleControl(p)
+				continue
+			}
+
+			msg, err := l.open(p)
+			if err != nil {
+				continue
+			}
+
+			q := *p
+			q.Payload = msg
+			select {
+			case out <- &q:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// MaxPayload is the largest message SendFrame accepts.
+func (l *Layer) MaxPayload() int {
+	return l.radio.MaxPayload() - headerLen - tagSize
+}
+
+func (l *Layer) seal(dst byte, msg []byte) ([]byte, error) {
+	if len(msg) > l.MaxPayload() {
+		return nil, errors.Wrapf(rfm69.ErrPayloadTooLarge, "%d bytes", len(msg))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	aead, ok := l.keys[l.epoch]
+	if !ok {
+		return nil, errors.Wrapf(ErrNoKey, "%d", l.epoch)
+	}
+
+	counter, err := l.nextCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := make([]byte, headerLen, headerLen+len(msg)+tagSize)
+	hdr[0] = l.epoch
+	binary.BigEndian.PutUint32(hdr[1:], counter)
+
+	return aead.Seal(hdr, nonce(l.addr, hdr), msg, aad(l.addr, dst, hdr)), nil
+}
+
+// nextCounter must be called with l.mu held.
+func (l *Layer) nextCounter() (uint32, error) {
+	if l.counter == ^uint32(0) {
+		return 0, errors.New("frame counter exhausted; rotate the key")
+	}
+	l.counter++
+	if l.counter > l.reserved {
+		l.reserved = l.counter + counterBlock
+		if l.reserved < l.counter {
+			l.reserved = ^uint32(0)
+		}
+		if err := l.counters.StoreCounter("tx", l.reserved); err != nil {
+			l.counter--
+			return 0, errors.Wrap(err, "store tx counter")
+		}
+	}
+	return l.counter, nil
+}
+
+func (l *Layer) open(p *rfm69.Packet) ([]byte, error) {
+	if len(p.Payload) < headerLen+tagSize {
+		return nil, ErrAuth
+	}
+	hdr := p.Payload[:headerLen]
+	counter := binary.BigEndian.Uint32(hdr[1:])
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	aead, ok := l.keys[hdr[0]]
+	if !ok {
+		l.stats.BadAuth++
+		return nil, errors.Wrapf(ErrNoKey, "%d", hdr[0])
+	}
+
+	msg, err := aead.Open(nil, nonce(p.Src, hdr), p.Payload[headerLen:], aad(p.Src, p.Dst, hdr))
+	if err != nil {
+		l.stats.BadAuth++
+		return nil, ErrAuth
+	}
+
+	// only checked once authentic, so forged counters can't lock a
+	// sender out
+	if err := l.accept(p.Src, counter); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// accept records counter as the latest from src, provided it is newer
+// than anything seen before. It must be called with l.mu held.
+func (l *Layer) accept(src byte, counter uint32) error {
+	last, seen := l.lastRx[src]
+	if !seen {
+		stored, err := l.counters.LoadCounter(rxName(src))
+		if err != nil {
+			return errors.Wrap(err, "load rx counter")
+		}
+		last = stored
+		l.rxStored[src] = stored
+	}
+
+	if counter <= last {
+		l.stats.Replayed++
+		return ErrReplay
+	}
+
+	if counter-l.rxStored[src] >= counterBlock {
+		if err := l.counters.StoreCounter(rxName(src), counter); err != nil {
+			return errors.Wrap(err, "store rx counter")
+		}
+		l.rxStored[src] = counter
+	}
+	l.lastRx[src] = counter
+	l.stats.Accepted++
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "key")
+	}
+	return newCCM(block, tagSize)
+}
+
+func rxName(src byte) string {
+	return fmt.Sprintf("rx/%d", src)
+}
+
+func nonce(src byte, hdr []byte) []byte {
+	n := make([]byte, ccmNonceSize)
+	n[0] = src
+	copy(n[1:], hdr) // epoch and counter
+	return n
+}
+
+func aad(src, dst byte, hdr []byte) []byte {
+	return append([]byte{src, dst}, hdr...)
+}
@@ -0,0 +1,162 @@
+package secure
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+)
+
+var key = []byte("0123456789abcdef")
+
+func newRadio(t *testing.T, m *sim.Medium, addr byte) *rfm69.Radio {
+	t.Helper()
+
+	r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(addr))
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func expect(t *testing.T, rx <-chan *rfm69.Packet, want string) {
+	t.Helper()
+
+	select {
+	case p := <-rx:
+		if string(p.Payload) != want {
+			t.Errorf("got %q, want %q", p.Payload, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%q not received", want)
+	}
+}
+
+func expectNothing(t *testing.T, rx <-chan *rfm69.Packet) {
+	t.Helper()
+
+	select {
+	case p := <-rx:
+		t.Errorf("unexpected %q", p.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSecureLayer(t *testing.T) {
+	m := sim.NewMedium()
+
+	a, err := New(newRadio(t, m, 1), key, WithCounterStore(&MemoryCounters{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(newRadio(t, m, 2), key, WithCounterStore(&MemoryCounters{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an attacker, sending as node 1
+	mallory := newRadio(t, m, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rx := make(chan *rfm69.Packet, 8)
+	go func() { _ = b.RxContext(ctx, rx) }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := a.SendFrame(2, []byte("unlock")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, rx, "unlock")
+
+	frame, err := a.seal(2, []byte("open door"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte(nil), frame...)
+	tampered[headerLen] ^= 1
+	if err := mallory.SendFrame(2, tampered); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, rx)
+
+	if err := mallory.SendFrame(2, frame); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, rx, "open door")
+
+	if err := mallory.SendFrame(2, frame); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, rx)
+
+	if s := b.Stats(); s.Accepted != 2 || s.BadAuth != 1 || s.Replayed != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestAddressesAuthenticated(t *testing.T) {
+	m := sim.NewMedium()
+	a, _ := New(newRadio(t, m, 1), key, WithCounterStore(&MemoryCounters{}))
+	c, _ := New(newRadio(t, m, 3), key, WithCounterStore(&MemoryCounters{}))
+
+	frame, err := a.seal(2, []byte("for 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.open(&rfm69.Packet{Src: 1, Dst: 3, Payload: frame}); err != ErrAuth {
+		t.Errorf("redirected frame: %v, want ErrAuth", err)
+	}
+	if _, err := c.open(&rfm69.Packet{Src: 4, Dst: 2, Payload: frame}); err != ErrAuth {
+		t.Errorf("frame from the wrong sender: %v, want ErrAuth", err)
+	}
+}
+
+func TestCountersSurviveRestart(t *testing.T) {
+	m := sim.NewMedium()
+	radio := newRadio(t, m, 1)
+	store := FileCounters(filepath.Join(t.TempDir(), "counters"))
+
+	if _, err := New(radio, key); err != ErrNoCounterStore {
+		t.Errorf("New without a counter store: %v", err)
+	}
+
+	a, _ := New(radio, key, WithCounterStore(store))
+	first, _ := a.seal(2, nil)
+
+	// a restarted node must not reuse counters
+	a, _ = New(radio, key, WithCounterStore(store))
+	second, _ := a.seal(2, nil)
+
+	rx := &MemoryCounters{}
+	bRadio := newRadio(t, m, 2)
+	b, _ := New(bRadio, key, WithCounterStore(rx))
+	if _, err := b.open(&rfm69.Packet{Src: 1, Dst: 2, Payload: second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.open(&rfm69.Packet{Src: 1, Dst: 2, Payload: first}); err != ErrReplay {
+		t.Errorf("frame from before the restart: %v, want ErrReplay", err)
+	}
+
+	// received counters are only stored a block apart
+	third, _ := a.seal(2, nil)
+	if _, err := b.open(&rfm69.Packet{Src: 1, Dst: 2, Payload: third}); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := rx.LoadCounter(rxName(1))
+	if want := binary.BigEndian.Uint32(second[1:]); n != want {
+		t.Errorf("stored rx counter = %d, want %d", n, want)
+	}
+
+	// a restarted receiver still rejects what was stored
+	b, _ = New(bRadio, key, WithCounterStore(rx))
+	if _, err := b.open(&rfm69.Packet{Src: 1, Dst: 2, Payload: second}); err != ErrReplay {
+		t.Errorf("frame from before the receiver restarted: %v, want ErrReplay", err)
+	}
+}
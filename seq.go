@@ -0,0 +1,121 @@
+package rfm69
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RF69_CTL_SEQ marks a frame whose first payload byte is the sender's
+// sequence number. LowPowerLab nodes leave this bit clear.
+const RF69_CTL_SEQ = 0x10
+
+const (
+	seqWindow = 32
+
+	// seqIdle is how long a sender must be quiet before its window is
+	// forgotten, so a node that rebooted isn't taken for a replay.
+	seqIdle = 5 * time.Minute
+)
+
+// WithSequenceNumbers makes SendFrame and SendWithRetry number frames, so
+// receivers can drop duplicates. Retries of one message share a number.
+// Numbering starts at random, so frames sent after a reboot are unlikely
+// to be taken for duplicates of ones sent before it.
+func WithSequenceNumbers() Option {
+	return func(r *Radio) {
+		r.seqOn = true
+		r.seq = byte(rand.Uint32())
+	}
+}
+
+type seqVerdict int
+
+const (
+	seqNew seqVerdict = iota
+	seqLate
+	seqDuplicate
+)
+
+// seqTracker keeps a sliding window of the sequence numbers recently
+// seen from each sender.
+type seqTracker struct {
+	mu      sync.Mutex
+	senders map[byte]*seqState
+}
+
+type seqState struct {
+	top  byte   // highest sequence number seen
+	seen uint32 // bit i set if top-i was seen
+	last time.Time
+}
+
+func (t *seqTracker) check(src, seq byte, now time.Time) seqVerdict {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.senders == nil {
+		t.senders = map[byte]*seqState{}
+	}
+
+	s, ok := t.senders[src]
+	if !ok || now.Sub(s.last) > seqIdle {
+		t.senders[src] = &seqState{top: seq, seen: 1, last: now}
+		return seqNew
+	}
+	s.last = now
+
+	diff := int(int8(seq - s.top))
+	switch {
+	case diff > 0:
+		if diff >= seqWindow {
+			s.seen = 0
+		} else {
+			s.seen <<= diff
+		}
+		s.seen |= 1
+		s.top = seq
+		return seqNew
+	case -diff >= seqWindow:
+		// too far back to be a late frame; the sender restarted
+		*s = seqState{top: seq, seen: 1, last: now}
+		return seqNew
+	case s.seen&(1<<-diff) != 0:
+		return seqDuplicate
+	default:
+		s.seen |= 1 << -diff
+		return seqLate
+	}
+}
+
+// MaxPayload is the largest message SendFrame takes: RF69_MAX_DATA_LEN,
+// less the sequence number if those are on.
+func (r *Radio) MaxPayload() int {
+	if r.seqOn {
+		return RF69_MAX_DATA_LEN - 1
+	}
+	return RF69_MAX_DATA_LEN
+}
+
+// withSeq numbers msg, if sequence numbers are on.
+func (r *Radio) withSeq(ctl byte, msg []byte) (byte, []byte) {
+	if !r.seqOn {
+		return ctl, msg
+	}
+
+	r.mu.Lock()
+	r.seq++
+	seq := r.seq
+	r.mu.Unlock()
+
+	return ctl | RF69_CTL_SEQ, append([]byte{seq}, msg...)
+}
+
+// splitSeq takes the sequence number off the front of a frame's payload.
+func splitSeq(p *Packet, ctl byte) {
+	if ctl&RF69_CTL_SEQ == 0 || len(p.Payload) == 0 {
+		return
+	}
+	p.Seq, p.HasSeq = p.Payload[0], true
+	p.Payload = p.Payload[1:]
+}
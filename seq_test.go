@@ -0,0 +1,53 @@
+package rfm69
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeqTracker(t *testing.T) {
+	var tr seqTracker
+	now := time.Now()
+
+	steps := []struct {
+		src, seq byte
+		want     seqVerdict
+	}{
+		{1, 10, seqNew},
+		{1, 10, seqDuplicate},
+		{1, 12, seqNew},
+		{1, 11, seqLate},
+		{1, 11, seqDuplicate},
+		{2, 11, seqNew}, // senders are tracked separately
+		{1, 100, seqNew},
+		{1, 200, seqNew},
+		{1, 250, seqNew},
+		{1, 5, seqNew}, // wraps
+		{1, 250, seqDuplicate},
+		{1, 200, seqNew}, // far behind: a restart
+		{1, 201, seqNew},
+	}
+
+	for i, s := range steps {
+		if got := tr.check(s.src, s.seq, now); got != s.want {
+			t.Errorf("step %d: check(%d, %d) = %d, want %d", i, s.src, s.seq, got, s.want)
+		}
+	}
+
+	// a long silence also starts over
+	if got := tr.check(1, 201, now.Add(seqIdle+time.Second)); got != seqNew {
+		t.Errorf("after idle: %d, want new", got)
+	}
+}
+
+func TestSeqStartsAtRandom(t *testing.T) {
+	starts := map[byte]bool{}
+	for i := 0; i < 10; i++ {
+		r := NewRadio(nil, WithSequenceNumbers())
+		_, frame := r.withSeq(0, nil)
+		starts[frame[0]] = true
+	}
+	if len(starts) == 1 {
+		t.Errorf("ten radios all started at %v", starts)
+	}
+}
@@ -0,0 +1,375 @@
+package sim
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+)
+
+// Board is a simulated module. It implements rfm69.Board.
+type Board struct {
+	medium *Medium
+	id     int
+	edges  chan struct{}
+
+	regs         [0x80]byte
+	fifo         []byte
+	payloadReady bool
+	packetSent   bool
+	fail         error
+}
+
+var resetValues = map[byte]byte{
+	rfm69.REG_OPMODE:        0x04,
+	rfm69.REG_BITRATEMSB:    0x1A,
+	rfm69.REG_BITRATELSB:    0x0B,
+	rfm69.REG_FDEVLSB:       0x52,
+	rfm69.REG_FRFMSB:        0xE4,
+	rfm69.REG_FRFMID:        0xC0,
+	rfm69.REG_VERSION:       0x24,
+	rfm69.REG_PALEVEL:       0x9F,
+	rfm69.REG_PARAMP:        0x09,
+	rfm69.REG_OCP:           0x1A,
+	rfm69.REG_RXBW:          0x55,
+	rfm69.REG_DIOMAPPING2:   0x07,
+	rfm69.REG_RSSITHRESH:    0xE4,
+	rfm69.REG_PREAMBLELSB:   0x03,
+	rfm69.REG_SYNCCONFIG:    0x98,
+	rfm69.REG_SYNCVALUE1:    0x01,
+	rfm69.REG_SYNCVALUE2:    0x01,
+	rfm69.REG_SYNCVALUE3:    0x01,
+	rfm69.REG_SYNCVALUE4:    0x01,
+	rfm69.REG_SYNCVALUE5:    0x01,
+	rfm69.REG_SYNCVALUE6:    0x01,
+	rfm69.REG_SYNCVALUE7:    0x01,
+	rfm69.REG_SYNCVALUE8:    0x01,
+	rfm69.REG_PACKETCONFIG1: 0x10,
+	rfm69.REG_PAYLOADLENGTH: 0x40,
+	rfm69.REG_FIFOTHRESH:    0x8F,
+	rfm69.REG_PACKETCONFIG2: 0x02,
+	rfm69.REG_TEMP1:         0x01,
+	rfm69.REG_TESTPA1:       0x55,
+	rfm69.REG_TESTPA2:       0x70,
+	rfm69.REG_TESTDAGC:      0x30,
+}
+
+// Fail makes every SPI transaction return err, simulating a dead bus.
+// A nil err restores the board.
+func (b *Board) Fail(err error) {
+	b.medium.mu.Lock()
+	defer b.medium.mu.Unlock()
+
+	b.fail = err
+}
+
+func (b *Board) TxSPI(w, r []byte) error {
+	b.medium.mu.Lock()
+	defer b.medium.mu.Unlock()
+
+	if b.fail != nil {
+		return b.fail
+	}
+	if len(w) == 0 {
+		return nil
+	}
+
+	addr := w[0] & 0x7F
+	write := w[0]&0x80 != 0
+	data := w[1:]
+
+	for i := range data {
+		var val byte
+		if write {
+			b.write(addr, data[i])
+		} else {
+			val = b.read(addr)
+		}
+		if r != nil {
+			r[1+i] = val
+		}
+
+		// bursts auto-increment, except on the FIFO
+		if addr != rfm69.REG_FIFO {
+			addr++
+		}
+	}
+
+	return nil
+}
+
+func (b *Board) Reset(active bool) error {
+	if !active {
+		return nil
+	}
+
+	b.medium.mu.Lock()
+	defer b.medium.mu.Unlock()
+
+	b.reset()
+	return nil
+}
+
+func (b *Board) WaitForD0Edge() {
+	<-b.edges
+}
+
+func (b *Board) reset() {
+	b.regs = [0x80]byte{}
+	for addr, val := range resetValues {
+		b.regs[addr] = val
+	}
+	b.fifo = nil
+	b.payloadReady = false
+	b.packetSent = false
+}
+
+// Asleep reports whether the module is in sleep mode.
+func (b *Board) Asleep() bool {
+	b.medium.mu.Lock()
+	defer b.medium.mu.Unlock()
+
+	return b.mode() == rfm69.RF_OPMODE_SLEEP
+}
+
+func (b *Board) mode() byte {
+	return b.regs[rfm69.REG_OPMODE] & 0x1C
+}
+
+func (b *Board) read(addr byte) byte {
+	switch addr {
+	case rfm69.REG_FIFO:
+		if len(b.fifo) == 0 {
+			return 0
+		}
+		val := b.fifo[0]
+		b.fifo = b.fifo[1:]
+		if len(b.fifo) == 0 {
+			b.payloadReady = false
+		}
+		return val
+	case rfm69.REG_IRQFLAGS1:
+		flags := byte(rfm69.RF_IRQFLAGS1_MODEREADY)
+		switch b.mode() {
+		case rfm69.RF_OPMODE_RECEIVER:
+			flags |= rfm69.RF_IRQFLAGS1_RXREADY | rfm69.RF_IRQFLAGS1_PLLLOCK
+		case rfm69.RF_OPMODE_TRANSMITTER:
+			flags |= rfm69.RF_IRQFLAGS1_TXREADY | rfm69.RF_IRQFLAGS1_PLLLOCK
+		}
+		return flags
+	case rfm69.REG_IRQFLAGS2:
+		var flags byte
+		if len(b.fifo) > 0 {
+			flags |= rfm69.RF_IRQFLAGS2_FIFONOTEMPTY
+		}
+		if b.payloadReady {
+			flags |= rfm69.RF_IRQFLAGS2_PAYLOADREADY | rfm69.RF_IRQFLAGS2_CRCOK
+		}
+		if b.packetSent {
+			flags |= rfm69.RF_IRQFLAGS2_PACKETSENT
+		}
+		return flags
+	default:
+		return b.regs[addr]
+	}
+}
+
+func (b *Board) write(addr byte, val byte) {
+	switch addr {
+	case rfm69.REG_FIFO:
+		b.fifo = append(b.fifo, val)
+	case rfm69.REG_OPMODE:
+		b.setMode(val)
+	case rfm69.REG_IRQFLAGS2:
+		if val&rfm69.RF_IRQFLAGS2_FIFOOVERRUN != 0 {
+			b.fifo = nil
+			b.payloadReady = false
+		}
+	case rfm69.REG_PACKETCONFIG2:
+		b.regs[addr] = val &^ rfm69.RF_PACKET2_RXRESTART
+		if val&rfm69.RF_PACKET2_RXRESTART != 0 && b.mode() == rfm69.RF_OPMODE_RECEIVER {
+			b.fifo = nil
+			b.payloadReady = false
+			b.setRSSI(b.medium.noise)
+		}
+	case rfm69.REG_TEMP1:
+		if val&rfm69.RF_TEMP1_MEAS_START != 0 {
+			b.regs[rfm69.REG_TEMP2] = 0x8C // 25 °C
+		}
+	case rfm69.REG_VERSION, rfm69.REG_IRQFLAGS1, rfm69.REG_RSSIVALUE, rfm69.REG_TEMP2:
+		// read only
+	default:
+		b.regs[addr] = val
+	}
+}
+
+func (b *Board) setMode(val byte) {
+	prev := b.mode()
+	b.regs[rfm69.REG_OPMODE] = val
+	mode := b.mode()
+
+	if prev == rfm69.RF_OPMODE_TRANSMITTER && mode != prev {
+		b.packetSent = false
+	}
+
+	switch {
+	case mode == rfm69.RF_OPMODE_RECEIVER && prev != mode:
+		if !b.payloadReady {
+			b.setRSSI(b.medium.noise)
+		}
+	case mode == rfm69.RF_OPMODE_TRANSMITTER && prev != mode:
+		b.transmit()
+	}
+}
+
+func (b *Board) transmit() {
+	if len(b.fifo) == 0 {
+		return
+	}
+
+	n := min(int(b.fifo[0])+1, len(b.fifo))
+	frame := append([]byte(nil), b.fifo[:n]...)
+	b.fifo = nil
+
+	if b.regs[rfm69.REG_PACKETCONFIG2]&rfm69.RF_PACKET2_AES_ON != 0 {
+		frame = b.scramble(frame)
+	}
+
+	// receivers get the frame, and the sender PacketSent, once it has
+	// been on the air for as long as it would take the real chip
+	deliver := func() {
+		b.medium.mu.Lock()
+		defer b.medium.mu.Unlock()
+
+		if b.mode() != rfm69.RF_OPMODE_TRANSMITTER {
+			return // aborted
+		}
+
+		b.medium.transmit(b, frame)
+
+		b.packetSent = true
+		if b.dio0() == 0 {
+			b.edge()
+		}
+	}
+
+	if b.medium.clock != nil {
+		b.medium.clock.AfterFunc(b.airtime(len(frame)), deliver)
+		return
+	}
+	time.AfterFunc(b.airtime(len(frame)), deliver)
+}
+
+func (b *Board) airtime(frameLen int) time.Duration {
+	preamble := int(b.regs[rfm69.REG_PREAMBLEMSB])<<8 | int(b.regs[rfm69.REG_PREAMBLELSB])
+	bits := 8 * (preamble + len(b.syncWord()) + frameLen + 2) // 2 CRC bytes
+
+	div := int(b.regs[rfm69.REG_BITRATEMSB])<<8 | int(b.regs[rfm69.REG_BITRATELSB])
+	if div == 0 {
+		div = 1
+	}
+
+	return time.Duration(bits) * time.Second * time.Duration(div) / fxosc
+}
+
+func (b *Board) receive(from *Board, frame []byte, rssi int) {
+	if b.mode() != rfm69.RF_OPMODE_RECEIVER || b.payloadReady {
+		return
+	}
+
+	for _, addr := range []byte{
+		rfm69.REG_FRFMSB, rfm69.REG_FRFMID, rfm69.REG_FRFLSB,
+		rfm69.REG_BITRATEMSB, rfm69.REG_BITRATELSB,
+	} {
+		if b.regs[addr] != from.regs[addr] {
+			return
+		}
+	}
+
+	if !bytes.Equal(b.syncWord(), from.syncWord()) {
+		return
+	}
+
+	if b.regs[rfm69.REG_PACKETCONFIG2]&rfm69.RF_PACKET2_AES_ON != 0 {
+		// a different key garbles the frame and fails the CRC
+		frame = b.scramble(frame)
+	}
+	if !b.acceptAddress(frame) {
+		return
+	}
+
+	b.fifo = append([]byte(nil), frame...)
+	b.payloadReady = true
+	b.setRSSI(rssi)
+
+	if dio0 := b.dio0(); dio0 == 0 || dio0 == 1 {
+		b.edge()
+	}
+}
+
+func (b *Board) syncWord() []byte {
+	cfg := b.regs[rfm69.REG_SYNCCONFIG]
+	if cfg&rfm69.RF_SYNC_ON == 0 {
+		return nil
+	}
+	n := int(cfg>>3&0x07) + 1
+	return b.regs[rfm69.REG_SYNCVALUE1 : rfm69.REG_SYNCVALUE1+n]
+}
+
+// scramble stands in for AES: XOR with the key is its own inverse, so
+// matching keys round trip and mismatched ones corrupt the frame. The
+// length byte is left in the clear, as on the chip.
+func (b *Board) scramble(frame []byte) []byte {
+	out := append([]byte(nil), frame...)
+	for i := 1; i < len(out); i++ {
+		out[i] ^= b.regs[rfm69.REG_AESKEY1+(i-1)%16]
+	}
+	return out
+}
+
+func (b *Board) acceptAddress(frame []byte) bool {
+	if len(frame) < 2 {
+		return false
+	}
+	dst := frame[1]
+
+	switch b.regs[rfm69.REG_PACKETCONFIG1] & 0x06 {
+	case rfm69.RF_PACKET1_ADRSFILTERING_NODE:
+		return dst == b.regs[rfm69.REG_NODEADRS]
+	case rfm69.RF_PACKET1_ADRSFILTERING_NODEBROADCAST:
+		return dst == b.regs[rfm69.REG_NODEADRS] || dst == b.regs[rfm69.REG_BROADCASTADRS]
+	default:
+		return true
+	}
+}
+
+func (b *Board) dio0() byte {
+	return b.regs[rfm69.REG_DIOMAPPING1] >> 6
+}
+
+func (b *Board) setRSSI(dBm int) {
+	b.regs[rfm69.REG_RSSIVALUE] = byte(min(max(-2*dBm, 0), 255))
+}
+
+func (b *Board) txPowerDBm() int {
+	pa := b.regs[rfm69.REG_PALEVEL]
+	level := int(pa & 0x1F)
+
+	switch {
+	case pa&rfm69.RF_PALEVEL_PA0_ON != 0:
+		return -18 + level
+	case pa&0x60 == 0x60 && b.regs[rfm69.REG_TESTPA1] == 0x5D:
+		return -11 + level
+	case pa&0x60 == 0x60:
+		return -14 + level
+	default:
+		return -18 + level
+	}
+}
+
+func (b *Board) edge() {
+	select {
+	case b.edges <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,131 @@
+package sim
+
+import (
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+)
+
+// SkewedClock is a node's clock that is off from the host's by Offset,
+// and runs fast by PPM parts per million (slow if negative) from Start.
+type SkewedClock struct {
+	Start  time.Time
+	Offset time.Duration
+	PPM    float64
+
+	// Base, if set, is the clock skewed instead of the host's.
+	Base rfm69.Clock
+}
+
+func NewSkewedClock(offset time.Duration, ppm float64) *SkewedClock {
+	return &SkewedClock{Start: time.Now(), Offset: offset, PPM: ppm}
+}
+
+func (c *SkewedClock) Now() time.Time {
+	now := time.Now()
+	if c.Base != nil {
+		now = c.Base.Now()
+	}
+	elapsed := now.Sub(c.Start)
+	return now.Add(c.Offset + time.Duration(float64(elapsed)*c.PPM/1e6))
+}
+
+// VirtualClock only moves when Advance is called, so schedules can be
+// tested without waiting on them.
+type VirtualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []vtimer
+}
+
+type vtimer struct {
+	at time.Time
+	ch chan time.Time
+	f  func()
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After is time.After by the virtual clock.
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, vtimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// AfterFunc calls f from Advance once d has passed on the virtual clock,
+// with the clock reading the time f was due.
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timers = append(c.timers, vtimer{at: c.now.Add(d), f: f})
+}
+
+// Next returns when the earliest pending timer is due.
+func (c *VirtualClock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[c.earliest()].at, true
+}
+
+// Advance moves the clock forward by d, firing timers that come due in
+// order, each at its own time.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+
+	for len(c.timers) > 0 {
+		i := c.earliest()
+		t := c.timers[i]
+		if t.at.After(end) {
+			break
+		}
+		c.timers = append(c.timers[:i], c.timers[i+1:]...)
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+
+		if t.f == nil {
+			t.ch <- t.at
+			continue
+		}
+		// f may use the clock, or take locks held while it is
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+
+	c.now = end
+	c.mu.Unlock()
+}
+
+func (c *VirtualClock) earliest() int {
+	i := 0
+	for j, t := range c.timers {
+		if t.at.Before(c.timers[i].at) {
+			i = j
+		}
+	}
+	return i
+}
@@ -0,0 +1,119 @@
+// Package sim simulates SX1231 modules sharing a radio medium, closely
+// enough to run the rfm69 driver against them without hardware.
+package sim
+
+import (
+	"sync"
+
+	"github.com/minor-industries/rfm69"
+)
+
+const (
+	defaultPathLoss = 80
+	noiseFloor      = -110
+	sensitivity     = -115
+
+	fxosc = 32_000_000
+)
+
+type link struct {
+	a, b *Board
+}
+
+func key(a, b *Board) link {
+	if a.id > b.id {
+		a, b = b, a
+	}
+	return link{a, b}
+}
+
+// Medium connects boards. All board state is guarded by the medium's
+// lock, so a transmission reaches every receiver atomically.
+type Medium struct {
+	mu       sync.Mutex
+	boards   []*Board
+	down     map[link]bool
+	pathLoss map[link]int
+	noise    int
+	clock    *VirtualClock
+}
+
+func NewMedium() *Medium {
+	return &Medium{
+		down:     map[link]bool{},
+		pathLoss: map[link]int{},
+		noise:    noiseFloor,
+	}
+}
+
+func (m *Medium) NewBoard() *Board {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := &Board{
+		medium: m,
+		id:     len(m.boards),
+		edges:  make(chan struct{}, 16),
+	}
+	b.reset()
+	m.boards = append(m.boards, b)
+	return b
+}
+
+// SetLink makes a and b able, or unable, to hear each other.
+func (m *Medium) SetLink(a, b *Board, up bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.down[key(a, b)] = !up
+}
+
+func (m *Medium) SetPathLoss(a, b *Board, dB int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pathLoss[key(a, b)] = dB
+}
+
+// SetClock times frames on the air by clock rather than the host's, so
+// they arrive as it is advanced, exactly one airtime after they are sent.
+func (m *Medium) SetClock(clock *VirtualClock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clock = clock
+}
+
+// SetNoise sets the RSSI, in dBm, that idle receivers report.
+func (m *Medium) SetNoise(dBm int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.noise = dBm
+	for _, b := range m.boards {
+		if b.mode() == rfm69.RF_OPMODE_RECEIVER && !b.payloadReady {
+			b.setRSSI(dBm)
+		}
+	}
+}
+
+func (m *Medium) transmit(from *Board, frame []byte) {
+	power := from.txPowerDBm()
+
+	for _, to := range m.boards {
+		if to == from || m.down[key(from, to)] {
+			continue
+		}
+
+		loss, ok := m.pathLoss[key(from, to)]
+		if !ok {
+			loss = defaultPathLoss
+		}
+		rssi := power - loss
+		if rssi < sensitivity {
+			continue
+		}
+
+		to.receive(from, frame, rssi)
+	}
+}
@@ -0,0 +1,364 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+)
+
+func newRadio(t *testing.T, m *Medium, addr byte) (*rfm69.Radio, *Board) {
+	t.Helper()
+
+	b := m.NewBoard()
+	r := rfm69.NewRadio(b, rfm69.WithAddress(addr))
+	if err := r.Setup(); err != nil {
+		t.Fatalf("setup %d: %v", addr, err)
+	}
+	return r, b
+}
+
+func receive(t *testing.T, r *rfm69.Radio) <-chan *rfm69.Packet {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	out := make(chan *rfm69.Packet, 8)
+	go func() { _ = r.RxContext(ctx, out) }()
+	time.Sleep(10 * time.Millisecond)
+	return out
+}
+
+func expect(t *testing.T, ch <-chan *rfm69.Packet) *rfm69.Packet {
+	t.Helper()
+
+	select {
+	case p := <-ch:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("no packet received")
+		return nil
+	}
+}
+
+func expectNothing(t *testing.T, ch <-chan *rfm69.Packet) {
+	t.Helper()
+
+	select {
+	case p := <-ch:
+		t.Fatalf("unexpected packet %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSendReceive(t *testing.T) {
+	m := NewMedium()
+	a, _ := newRadio(t, m, 1)
+	b, _ := newRadio(t, m, 2)
+
+	rx := receive(t, b)
+
+	if err := a.SendFrame(2, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := expect(t, rx)
+	if p.Src != 1 || p.Dst != 2 || string(p.Payload) != "hello" {
+		t.Errorf("got %+v", p)
+	}
+	if p.RSSI != 13-defaultPathLoss {
+		t.Errorf("rssi = %d, want %d", p.RSSI, 13-defaultPathLoss)
+	}
+}
+
+func TestLinkDown(t *testing.T) {
+	m := NewMedium()
+	a, ab := newRadio(t, m, 1)
+	b, bb := newRadio(t, m, 2)
+
+	rx := receive(t, b)
+	m.SetLink(ab, bb, false)
+
+	if err := a.SendFrame(2, []byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, rx)
+
+	m.SetLink(ab, bb, true)
+	if err := a.SendFrame(2, []byte("found")); err != nil {
+		t.Fatal(err)
+	}
+	if p := expect(t, rx); string(p.Payload) != "found" {
+		t.Errorf("payload = %q", p.Payload)
+	}
+}
+
+func TestEncryptionKeyMismatch(t *testing.T) {
+	m := NewMedium()
+	a, _ := newRadio(t, m, 1)
+	b, _ := newRadio(t, m, 2)
+
+	key := []byte("0123456789abcdef")
+	if err := a.SetEncryptionKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetEncryptionKey([]byte("fedcba9876543210")); err != nil {
+		t.Fatal(err)
+	}
+
+	rx := receive(t, b)
+
+	if err := a.SendFrame(2, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if p := expect(t, rx); string(p.Payload) == "secret" {
+		t.Error("frame decrypted with the wrong key")
+	}
+}
+
+func TestAck(t *testing.T) {
+	m := NewMedium()
+	a, _ := newRadio(t, m, 1)
+	b, _ := newRadio(t, m, 2)
+
+	receive(t, a)
+	rx := receive(t, b)
+
+	if err := a.SendWithRetry(2, []byte("ping"), 2, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if p := expect(t, rx); string(p.Payload) != "ping" {
+		t.Errorf("payload = %q", p.Payload)
+	}
+}
+
+func TestDuplicateSuppression(t *testing.T) {
+	m := NewMedium()
+
+	ab := m.NewBoard()
+	a := rfm69.NewRadio(ab, rfm69.WithAddress(1), rfm69.WithSequenceNumbers())
+	if err := a.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// b hears a, but is too quiet for its acks to make it back
+	bb := m.NewBoard()
+	metrics := rfm69.NewMetrics()
+	b := rfm69.NewRadio(bb, rfm69.WithAddress(2), rfm69.WithTxPower(-2), rfm69.WithMetrics(metrics))
+	if err := b.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPowerDBm(-2); err != nil {
+		t.Fatal(err)
+	}
+	m.SetPathLoss(ab, bb, 120)
+
+	receive(t, a)
+	rx := receive(t, b)
+
+	err := a.SendWithRetry(2, []byte("reading"), 2, 50*time.Millisecond)
+	if !errors.Is(err, rfm69.ErrTimeout) {
+		t.Fatalf("send: %v, want timeout", err)
+	}
+
+	p := expect(t, rx)
+	if !p.HasSeq || string(p.Payload) != "reading" {
+		t.Errorf("got %+v", p)
+	}
+	expectNothing(t, rx)
+
+	var buf bytes.Buffer
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "rfm69_duplicates_total 2\n") {
+		t.Errorf("metrics:\n%s", buf.String())
+	}
+
+	// the next message is new
+	if err := a.SendFrame(2, []byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	if next := expect(t, rx); next.Seq != p.Seq+1 || string(next.Payload) != "next" {
+		t.Errorf("got %+v after seq %d", next, p.Seq)
+	}
+}
+
+func TestMaxPayloadWithSeq(t *testing.T) {
+	m := NewMedium()
+	a := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(1), rfm69.WithSequenceNumbers())
+	if err := a.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = newRadio(t, m, 2)
+
+	if n := a.MaxPayload(); n != rfm69.RF69_MAX_DATA_LEN-1 {
+		t.Fatalf("max payload = %d", n)
+	}
+	if err := a.SendFrame(2, make([]byte, a.MaxPayload())); err != nil {
+		t.Error(err)
+	}
+	if err := a.SendFrame(2, make([]byte, a.MaxPayload()+1)); !errors.Is(err, rfm69.ErrPayloadTooLarge) {
+		t.Errorf("oversize send: %v", err)
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	m := NewMedium()
+
+	for _, cfg := range []rfm69.Config{
+		{Band: rfm69.RF69_915MHZ, BitRate: 40_000_000},
+		{Band: rfm69.RF69_915MHZ, BitRate: 100},
+		{Band: rfm69.RF69_915MHZ, BitRate: -5},
+		{Band: 7, BitRate: 55555},
+	} {
+		r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(1), rfm69.WithConfig(cfg))
+		if err := r.Setup(); !errors.Is(err, rfm69.ErrBadConfig) {
+			t.Errorf("setup with %+v: %v", cfg, err)
+		}
+	}
+
+	r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(1), rfm69.WithConfig(rfm69.Config{
+		Band:      7,
+		BitRate:   489,
+		Frequency: 915_000_000,
+	}))
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if br := r.BitRate(); br < 489 || br > 490 {
+		t.Errorf("bit rate = %d", br)
+	}
+}
+
+func TestBroadcastAndGroups(t *testing.T) {
+	m := NewMedium()
+
+	for _, addr := range []byte{rfm69.RF69_BROADCAST_ADDR, rfm69.GroupAddr(5)} {
+		r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(addr))
+		if err := r.Setup(); !errors.Is(err, rfm69.ErrBadAddress) {
+			t.Errorf("setup at 0x%02x: %v", addr, err)
+		}
+	}
+
+	a, _ := newRadio(t, m, 1)
+
+	filtered := func(addr byte) (*rfm69.Radio, *Board) {
+		b := m.NewBoard()
+		r := rfm69.NewRadio(b, rfm69.WithAddress(addr), rfm69.WithAddressFiltering())
+		if err := r.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		return r, b
+	}
+
+	member, mb := filtered(2)
+	other, ob := filtered(3)
+	sniffer, _ := newRadio(t, m, 4)
+
+	if err := member.JoinGroup(5); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chip filters until a group is joined
+	if f := mb.regs[rfm69.REG_PACKETCONFIG1] & 0x06; f != rfm69.RF_PACKET1_ADRSFILTERING_OFF {
+		t.Errorf("member's chip filter = %#x", f)
+	}
+	if f := ob.regs[rfm69.REG_PACKETCONFIG1] & 0x06; f != rfm69.RF_PACKET1_ADRSFILTERING_NODEBROADCAST {
+		t.Errorf("other's chip filter = %#x", f)
+	}
+
+	receive(t, a)
+	rxMember, rxOther, rxSniffer := receive(t, member), receive(t, other), receive(t, sniffer)
+
+	if err := a.SendFrame(rfm69.RF69_BROADCAST_ADDR, []byte("all lights off")); err != nil {
+		t.Fatal(err)
+	}
+	for _, rx := range []<-chan *rfm69.Packet{rxMember, rxOther, rxSniffer} {
+		expect(t, rx)
+	}
+
+	if err := a.SendFrame(rfm69.GroupAddr(5), []byte("firmware 1.2")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, rxMember)
+	expect(t, rxSniffer)
+	expectNothing(t, rxOther)
+
+	if err := a.SendFrame(4, []byte("for the sniffer")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, rxSniffer)
+	expectNothing(t, rxMember)
+	expectNothing(t, rxOther)
+
+	for _, dst := range []byte{rfm69.RF69_BROADCAST_ADDR, rfm69.GroupAddr(5)} {
+		if err := a.SendWithRetry(dst, nil, 1, 50*time.Millisecond); !errors.Is(err, rfm69.ErrNotAcked) {
+			t.Errorf("acked send to 0x%02x: %v", dst, err)
+		}
+	}
+
+	if err := member.LeaveGroup(5); err != nil {
+		t.Fatal(err)
+	}
+	if g := member.Groups(); len(g) != 0 {
+		t.Errorf("groups after leaving: %v", g)
+	}
+	if err := a.SendFrame(rfm69.GroupAddr(5), []byte("firmware 1.3")); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, rxMember)
+}
+
+func TestSupervisorChecks(t *testing.T) {
+	m := NewMedium()
+
+	// sequence numbers drop the repeats of frames whose ack was lost
+	a := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(1), rfm69.WithSequenceNumbers())
+	if err := a.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newRadio(t, m, 2)
+	receive(t, a)
+
+	// the other fields default
+	cfg := rfm69.SupervisorConfig{CheckInterval: 5 * time.Millisecond}
+	s := rfm69.NewSupervisor(b, cfg, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rx := make(chan *rfm69.Packet)
+	go func() { _ = s.Run(ctx, rx) }()
+	time.Sleep(10 * time.Millisecond)
+
+	const n = 30
+	sent := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			// frames in the air during a check are retried
+			if err := a.SendWithRetry(2, []byte{byte(i)}, 5, 20*time.Millisecond); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+
+	for i := 0; i < n; i++ {
+		if p := expect(t, rx); p.Payload[0] != byte(i) {
+			t.Fatalf("got frame %d, want %d", p.Payload[0], i)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if s.Recoveries() != 0 {
+		t.Errorf("%d recoveries", s.Recoveries())
+	}
+}
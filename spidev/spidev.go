@@ -0,0 +1,203 @@
+//go:build linux
+
+// Package spidev is an rfm69.Board for Linux, using /dev/spidev for the
+// bus and sysfs GPIO for the reset and DIO0 lines.
+package spidev
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	spiIOCMessage1     = 0x40206B00 // SPI_IOC_MESSAGE(1)
+	spiIOCWrMode       = 0x40016B01
+	spiIOCWrBitsPerWrd = 0x40016B03
+	spiIOCWrMaxSpeedHz = 0x40046B04
+)
+
+// spiIOCTransfer mirrors struct spi_ioc_transfer.
+type spiIOCTransfer struct {
+	txBuf       uint64
+	rxBuf       uint64
+	length      uint32
+	speedHz     uint32
+	delayUsecs  uint16
+	bitsPerWord uint8
+	csChange    uint8
+	txNbits     uint8
+	rxNbits     uint8
+	wordDelay   uint8
+	pad         uint8
+}
+
+type Config struct {
+	Device  string // e.g. /dev/spidev0.0
+	SpeedHz uint32
+	Reset   int // GPIO number of the RESET line
+	DIO0    int // GPIO number of the DIO0 line
+}
+
+var DefaultConfig = Config{
+	Device:  "/dev/spidev0.0",
+	SpeedHz: 4_000_000,
+	Reset:   25,
+	DIO0:    24,
+}
+
+type Board struct {
+	spi   *os.File
+	speed uint32
+	reset *os.File
+	dio0  *os.File
+}
+
+func Open(cfg Config) (*Board, error) {
+	spi, err := os.OpenFile(cfg.Device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "open spi device")
+	}
+
+	b := &Board{spi: spi, speed: cfg.SpeedHz}
+
+	fd := int(spi.Fd())
+	if err := ioctlByte(fd, spiIOCWrMode, 0); err != nil {
+		b.Close()
+		return nil, errors.Wrap(err, "set spi mode")
+	}
+	if err := ioctlByte(fd, spiIOCWrBitsPerWrd, 8); err != nil {
+		b.Close()
+		return nil, errors.Wrap(err, "set bits per word")
+	}
+	speed := cfg.SpeedHz
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), spiIOCWrMaxSpeedHz, uintptr(unsafe.Pointer(&speed))); errno != 0 {
+		b.Close()
+		return nil, errors.Wrap(errno, "set spi speed")
+	}
+
+	if b.reset, err = exportGPIO(cfg.Reset, "out", ""); err != nil {
+		b.Close()
+		return nil, errors.Wrap(err, "reset gpio")
+	}
+	if b.dio0, err = exportGPIO(cfg.DIO0, "in", "rising"); err != nil {
+		b.Close()
+		return nil, errors.Wrap(err, "dio0 gpio")
+	}
+
+	return b, nil
+}
+
+func (b *Board) Close() error {
+	for _, f := range []*os.File{b.spi, b.reset, b.dio0} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	return nil
+}
+
+func (b *Board) TxSPI(w, r []byte) error {
+	if r == nil {
+		r = make([]byte, len(w))
+	}
+	if len(r) < len(w) {
+		return fmt.Errorf("read buffer too short: %d < %d", len(r), len(w))
+	}
+	if len(w) == 0 {
+		return nil
+	}
+
+	tr := spiIOCTransfer{
+		txBuf:       uint64(uintptr(unsafe.Pointer(&w[0]))),
+		rxBuf:       uint64(uintptr(unsafe.Pointer(&r[0]))),
+		length:      uint32(len(w)),
+		speedHz:     b.speed,
+		bitsPerWord: 8,
+	}
+
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		b.spi.Fd(),
+		spiIOCMessage1,
+		uintptr(unsafe.Pointer(&tr)),
+	)
+	// tr holds the buffers' addresses as plain integers
+	runtime.KeepAlive(w)
+	runtime.KeepAlive(r)
+	if errno != 0 {
+		return errors.Wrap(errno, "spi transfer")
+	}
+	return nil
+}
+
+func (b *Board) Reset(active bool) error {
+	val := "0"
+	if active {
+		val = "1"
+	}
+	_, err := b.reset.WriteAt([]byte(val), 0)
+	return err
+}
+
+// WaitForD0Edge blocks until DIO0 rises.
+func (b *Board) WaitForD0Edge() {
+	buf := make([]byte, 2)
+	fds := []unix.PollFd{{Fd: int32(b.dio0.Fd()), Events: unix.POLLPRI | unix.POLLERR}}
+
+	for {
+		// reading clears the pending event
+		_, _ = b.dio0.ReadAt(buf, 0)
+
+		n, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			// avoid spinning if the line has gone away
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if n > 0 {
+			_, _ = b.dio0.ReadAt(buf, 0)
+			return
+		}
+	}
+}
+
+func ioctlByte(fd int, req uint, val byte) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(unsafe.Pointer(&val)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func exportGPIO(pin int, direction, edge string) (*os.File, error) {
+	dir := "/sys/class/gpio/gpio" + strconv.Itoa(pin)
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.WriteFile("/sys/class/gpio/export", []byte(strconv.Itoa(pin)), 0); err != nil {
+			return nil, errors.Wrap(err, "export")
+		}
+		// udev needs a moment to fix up permissions
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := os.WriteFile(dir+"/direction", []byte(direction), 0); err != nil {
+		return nil, errors.Wrap(err, "set direction")
+	}
+	if edge != "" {
+		if err := os.WriteFile(dir+"/edge", []byte(edge), 0); err != nil {
+			return nil, errors.Wrap(err, "set edge")
+		}
+	}
+
+	return os.OpenFile(dir+"/value", os.O_RDWR, 0)
+}
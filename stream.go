@@ -0,0 +1,294 @@
+package rfm69
+
+//go:generate msgp
+//msgp:ignore PacketReader PacketWriter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A packet stream starts with a header, the magic string followed by a
+// big endian uint16 length and a msgp encoded StreamHeader. Each packet
+// is then framed as
+//
+//	0..1  0xA5 0x5A
+//	2..3  body length, big endian
+//	4..7  CRC-32 (IEEE) of the body, big endian
+//	8..   msgp encoded Packet
+//
+// Headers may recur mid-stream, as when logs are concatenated.
+const (
+	streamMagic   = "RFM69PKT"
+	StreamVersion = 1
+
+	frameHeaderLen = 8
+	maxFrameBody   = 4096
+)
+
+var frameMarker = []byte{0xA5, 0x5A}
+
+type StreamHeader struct {
+	Version   int
+	Created   time.Time
+	Node      byte
+	Band      byte
+	NetworkID byte
+	BitRate   int
+	Frequency uint32
+}
+
+// NewStreamHeader describes a stream of packets received with cfg.
+func NewStreamHeader(node byte, cfg Config) *StreamHeader {
+	return &StreamHeader{
+		Version:   StreamVersion,
+		Created:   time.Now(),
+		Node:      node,
+		Band:      cfg.Band,
+		NetworkID: cfg.NetworkID,
+		BitRate:   cfg.BitRate,
+		Frequency: cfg.Frequency,
+	}
+}
+
+func (h *StreamHeader) Config() Config {
+	return Config{
+		Band:      h.Band,
+		NetworkID: h.NetworkID,
+		BitRate:   h.BitRate,
+		Frequency: h.Frequency,
+	}
+}
+
+type PacketWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewPacketWriter writes hdr, if it is not nil, then returns a writer
+// for the packets that follow. Pass a nil hdr to continue a stream.
+func NewPacketWriter(w io.Writer, hdr *StreamHeader) (*PacketWriter, error) {
+	pw := &PacketWriter{w: w}
+
+	if hdr != nil {
+		body, err := hdr.MarshalMsg(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "encode header")
+		}
+
+		buf := append([]byte(streamMagic), 0, 0)
+		binary.BigEndian.PutUint16(buf[len(streamMagic):], uint16(len(body)))
+		if _, err := w.Write(append(buf, body...)); err != nil {
+			return nil, errors.Wrap(err, "write header")
+		}
+	}
+
+	return pw, nil
+}
+
+// AppendPacketFile opens path for appending, creating it if needed. The
+// header is only written to a new, empty file.
+func AppendPacketFile(path string, hdr *StreamHeader) (*PacketWriter, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if fi.Size() > 0 {
+		hdr = nil
+	}
+
+	pw, err := NewPacketWriter(f, hdr)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return pw, f, nil
+}
+
+// Write frames p and writes it in a single call, so concurrent writers
+// on a file opened for appending do not interleave.
+func (pw *PacketWriter) Write(p *Packet) error {
+	buf := append(pw.buf[:0], make([]byte, frameHeaderLen)...)
+	buf, err := p.MarshalMsg(buf)
+	if err != nil {
+		return errors.Wrap(err, "encode packet")
+	}
+
+	body := buf[frameHeaderLen:]
+	if len(body) > maxFrameBody {
+		return ErrPayloadTooLarge
+	}
+
+	copy(buf, frameMarker)
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(body)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(body))
+	pw.buf = buf
+
+	_, err = pw.w.Write(buf)
+	return err
+}
+
+type PacketReader struct {
+	r       *bufio.Reader
+	hdr     StreamHeader
+	skipped int64
+}
+
+// NewPacketReader reads the stream header from r.
+func NewPacketReader(r io.Reader) (*PacketReader, error) {
+	pr := &PacketReader{r: bufio.NewReaderSize(r, frameHeaderLen+maxFrameBody)}
+
+	magic, err := pr.r.Peek(len(streamMagic))
+	if err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+	if string(magic) != streamMagic {
+		return nil, errors.New("not a packet stream")
+	}
+	if err := pr.readHeader(); err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
+
+// Header returns the most recent stream header.
+func (pr *PacketReader) Header() StreamHeader {
+	return pr.hdr
+}
+
+// Skipped returns the number of bytes discarded while resynchronizing
+// after corrupt or truncated frames.
+func (pr *PacketReader) Skipped() int64 {
+	return pr.skipped
+}
+
+// Next returns the next packet. Damaged frames are skipped; a partial
+// frame at the end of the stream is treated as its end.
+func (pr *PacketReader) Next() (*Packet, error) {
+	for {
+		peek, err := pr.r.Peek(len(streamMagic))
+		switch {
+		case err == nil && string(peek) == streamMagic:
+			if err := pr.readHeader(); err != nil {
+				pr.skip(1)
+			}
+			continue
+		case len(peek) == 0 && err != nil:
+			return nil, err
+		}
+
+		p, ok, err := pr.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return p, nil
+		}
+	}
+}
+
+func (pr *PacketReader) readHeader() error {
+	hdr, err := pr.r.Peek(len(streamMagic) + 2)
+	if err != nil {
+		return errors.Wrap(err, "read header")
+	}
+
+	n := int(binary.BigEndian.Uint16(hdr[len(streamMagic):]))
+	buf, err := pr.r.Peek(len(hdr) + n)
+	if err != nil {
+		return errors.Wrap(err, "read header")
+	}
+
+	var h StreamHeader
+	if _, err := h.UnmarshalMsg(buf[len(hdr):]); err != nil {
+		return errors.Wrap(err, "decode header")
+	}
+	if h.Version > StreamVersion {
+		return errors.Errorf("unsupported stream version %d", h.Version)
+	}
+
+	pr.hdr = h
+	_, _ = pr.r.Discard(len(buf))
+	return nil
+}
+
+// readFrame reads one frame at the current position. If it is damaged
+// it skips to the next possible frame start and returns ok = false.
+func (pr *PacketReader) readFrame() (*Packet, bool, error) {
+	hdr, err := pr.r.Peek(frameHeaderLen)
+	if err != nil {
+		return nil, false, pr.atEOF(err)
+	}
+
+	n := int(binary.BigEndian.Uint16(hdr[2:]))
+	if !bytes.Equal(hdr[:2], frameMarker) || n > maxFrameBody {
+		pr.resync()
+		return nil, false, nil
+	}
+	sum := binary.BigEndian.Uint32(hdr[4:])
+
+	buf, err := pr.r.Peek(frameHeaderLen + n)
+	if err != nil && len(buf) < frameHeaderLen+n {
+		if err == io.EOF {
+			// a truncated frame with nothing after it
+			pr.skip(len(buf))
+			return nil, false, io.EOF
+		}
+		return nil, false, err
+	}
+
+	body := buf[frameHeaderLen:]
+	var p Packet
+	if crc32.ChecksumIEEE(body) != sum {
+		pr.resync()
+		return nil, false, nil
+	}
+	if _, err := p.UnmarshalMsg(body); err != nil {
+		pr.resync()
+		return nil, false, nil
+	}
+
+	_, _ = pr.r.Discard(len(buf))
+	return &p, true, nil
+}
+
+// resync drops the byte at the current position and whatever follows
+// it, in what is already buffered, that cannot start a frame or header.
+func (pr *PacketReader) resync() {
+	pr.skip(1)
+
+	buf, _ := pr.r.Peek(pr.r.Buffered())
+	for i, b := range buf {
+		if b == frameMarker[0] || b == streamMagic[0] {
+			pr.skip(i)
+			return
+		}
+	}
+	pr.skip(len(buf))
+}
+
+func (pr *PacketReader) skip(n int) {
+	n, _ = pr.r.Discard(n)
+	pr.skipped += int64(n)
+}
+
+func (pr *PacketReader) atEOF(err error) error {
+	if err == io.EOF {
+		pr.skip(pr.r.Buffered())
+	}
+	return err
+}
@@ -0,0 +1,260 @@
+package rfm69
+
+// Code generated by github.com/tinylib/msgp DO NOT EDIT.
+
+import (
+	"github.com/tinylib/msgp/msgp"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *StreamHeader) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Version":
+			z.Version, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		case "Created":
+			z.Created, err = dc.ReadTime()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "Node":
+			z.Node, err = dc.ReadByte()
+			if err != nil {
+				err = msgp.WrapError(err, "Node")
+				return
+			}
+		case "Band":
+			z.Band, err = dc.ReadByte()
+			if err != nil {
+				err = msgp.WrapError(err, "Band")
+				return
+			}
+		case "NetworkID":
+			z.NetworkID, err = dc.ReadByte()
+			if err != nil {
+				err = msgp.WrapError(err, "NetworkID")
+				return
+			}
+		case "BitRate":
+			z.BitRate, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "BitRate")
+				return
+			}
+		case "Frequency":
+			z.Frequency, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Frequency")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *StreamHeader) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 7
+	// write "Version"
+	err = en.Append(0x87, 0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.Version)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	// write "Created"
+	err = en.Append(0xa7, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteTime(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	// write "Node"
+	err = en.Append(0xa4, 0x4e, 0x6f, 0x64, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteByte(z.Node)
+	if err != nil {
+		err = msgp.WrapError(err, "Node")
+		return
+	}
+	// write "Band"
+	err = en.Append(0xa4, 0x42, 0x61, 0x6e, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteByte(z.Band)
+	if err != nil {
+		err = msgp.WrapError(err, "Band")
+		return
+	}
+	// write "NetworkID"
+	err = en.Append(0xa9, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x49, 0x44)
+	if err != nil {
+		return
+	}
+	err = en.WriteByte(z.NetworkID)
+	if err != nil {
+		err = msgp.WrapError(err, "NetworkID")
+		return
+	}
+	// write "BitRate"
+	err = en.Append(0xa7, 0x42, 0x69, 0x74, 0x52, 0x61, 0x74, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.BitRate)
+	if err != nil {
+		err = msgp.WrapError(err, "BitRate")
+		return
+	}
+	// write "Frequency"
+	err = en.Append(0xa9, 0x46, 0x72, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x79)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Frequency)
+	if err != nil {
+		err = msgp.WrapError(err, "Frequency")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *StreamHeader) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 7
+	// string "Version"
+	o = append(o, 0x87, 0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendInt(o, z.Version)
+	// string "Created"
+	o = append(o, 0xa7, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64)
+	o = msgp.AppendTime(o, z.Created)
+	// string "Node"
+	o = append(o, 0xa4, 0x4e, 0x6f, 0x64, 0x65)
+	o = msgp.AppendByte(o, z.Node)
+	// string "Band"
+	o = append(o, 0xa4, 0x42, 0x61, 0x6e, 0x64)
+	o = msgp.AppendByte(o, z.Band)
+	// string "NetworkID"
+	o = append(o, 0xa9, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x49, 0x44)
+	o = msgp.AppendByte(o, z.NetworkID)
+	// string "BitRate"
+	o = append(o, 0xa7, 0x42, 0x69, 0x74, 0x52, 0x61, 0x74, 0x65)
+	o = msgp.AppendInt(o, z.BitRate)
+	// string "Frequency"
+	o = append(o, 0xa9, 0x46, 0x72, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x79)
+	o = msgp.AppendUint32(o, z.Frequency)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *StreamHeader) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Version":
+			z.Version, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		case "Created":
+			z.Created, bts, err = msgp.ReadTimeBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "Node":
+			z.Node, bts, err = msgp.ReadByteBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Node")
+				return
+			}
+		case "Band":
+			z.Band, bts, err = msgp.ReadByteBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Band")
+				return
+			}
+		case "NetworkID":
+			z.NetworkID, bts, err = msgp.ReadByteBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "NetworkID")
+				return
+			}
+		case "BitRate":
+			z.BitRate, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "BitRate")
+				return
+			}
+		case "Frequency":
+			z.Frequency, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Frequency")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *StreamHeader) Msgsize() (s int) {
+	s = 1 + 8 + msgp.IntSize + 8 + msgp.TimeSize + 5 + msgp.ByteSize + 5 + msgp.ByteSize + 10 + msgp.ByteSize + 8 + msgp.IntSize + 10 + msgp.Uint32Size
+	return
+}
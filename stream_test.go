@@ -0,0 +1,123 @@
+package rfm69
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readAll(t *testing.T, r io.Reader) ([]*Packet, *PacketReader) {
+	t.Helper()
+
+	pr, err := NewPacketReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*Packet
+	for {
+		p, err := pr.Next()
+		if err == io.EOF {
+			return got, pr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+}
+
+func TestPacketStream(t *testing.T) {
+	var buf bytes.Buffer
+	pw, err := NewPacketWriter(&buf, NewStreamHeader(1, DefaultConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := pw.Write(&Packet{Src: byte(i), Dst: 1, RSSI: -50 - i, Payload: []byte{byte(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, pr := readAll(t, &buf)
+	if len(got) != 3 {
+		t.Fatalf("read %d packets, want 3", len(got))
+	}
+	if got[2].Src != 2 || got[2].RSSI != -52 || !bytes.Equal(got[2].Payload, []byte{2}) {
+		t.Errorf("got %+v", got[2])
+	}
+	if hdr := pr.Header(); hdr.Version != StreamVersion || hdr.Config() != DefaultConfig {
+		t.Errorf("header = %+v", hdr)
+	}
+}
+
+func TestPacketStreamResync(t *testing.T) {
+	var buf bytes.Buffer
+	pw, err := NewPacketWriter(&buf, NewStreamHeader(1, DefaultConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(s string) {
+		if err := pw.Write(&Packet{Src: 2, Payload: []byte(s)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first")
+	mark := buf.Len()
+	write("truncated")
+	buf.Truncate(buf.Len() - 4) // as if the writer died mid-frame
+	write("second")
+	buf.WriteString("garbage\xa5")
+	write("third")
+	buf.Bytes()[buf.Len()-1] ^= 0xFF // corrupt the last frame's body
+	cut := buf.Len()
+	write("fourth")
+	buf.Truncate(buf.Len() - 2)
+
+	got, pr := readAll(t, bytes.NewReader(buf.Bytes()))
+
+	var payloads []string
+	for _, p := range got {
+		payloads = append(payloads, string(p.Payload))
+	}
+	if len(payloads) != 2 || payloads[0] != "first" || payloads[1] != "second" {
+		t.Errorf("payloads = %q", payloads)
+	}
+	if pr.Skipped() == 0 || pr.Skipped() > int64(cut-mark)+20 {
+		t.Errorf("skipped %d bytes", pr.Skipped())
+	}
+}
+
+func TestAppendPacketFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packets.log")
+
+	for i := 0; i < 2; i++ {
+		pw, f, err := AppendPacketFile(path, NewStreamHeader(1, DefaultConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pw.Write(&Packet{Src: byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, pr := readAll(t, f)
+	if len(got) != 2 || got[0].Src != 0 || got[1].Src != 1 {
+		t.Errorf("got %+v", got)
+	}
+	if pr.Skipped() != 0 {
+		t.Errorf("skipped %d bytes", pr.Skipped())
+	}
+}
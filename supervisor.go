@@ -0,0 +1,325 @@
+package rfm69
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+type SupervisorConfig struct {
+	// CheckInterval is how often RX is paused to check on the chip.
+	CheckInterval time.Duration
+
+	// The chip is considered wedged if nothing was received for
+	// IdleTimeout while the channel RSSI is at or above ActivityRSSI.
+	IdleTimeout  time.Duration
+	ActivityRSSI int
+
+	// MaxTimeouts is the number of consecutive send timeouts that
+	// trigger a recovery.
+	MaxTimeouts int
+}
+
+var DefaultSupervisorConfig = SupervisorConfig{
+	CheckInterval: time.Minute,
+	IdleTimeout:   10 * time.Minute,
+	ActivityRSSI:  CSMA_LIMIT,
+	MaxTimeouts:   3,
+}
+
+type RecoveryEvent struct {
+	Time   time.Time
+	Reason string
+	Err    error
+
+	// Count is the total number of recoveries, including this one.
+	Count int
+}
+
+type Supervisor struct {
+	radio     *Radio
+	cfg       SupervisorConfig
+	onRecover func(RecoveryEvent)
+
+	kick chan string
+
+	mu         sync.Mutex
+	lastRx     time.Time
+	timeouts   int
+	recoveries int
+}
+
+// NewSupervisor returns a supervisor for radio, with zero fields of cfg
+// taken from DefaultSupervisorConfig.
+func NewSupervisor(
+	radio *Radio,
+	cfg SupervisorConfig,
+	onRecover func(RecoveryEvent),
+) *Supervisor {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DefaultSupervisorConfig.CheckInterval
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultSupervisorConfig.IdleTimeout
+	}
+	if cfg.ActivityRSSI == 0 {
+		cfg.ActivityRSSI = DefaultSupervisorConfig.ActivityRSSI
+	}
+	if cfg.MaxTimeouts <= 0 {
+		cfg.MaxTimeouts = DefaultSupervisorConfig.MaxTimeouts
+	}
+
+	if onRecover == nil {
+		onRecover = func(RecoveryEvent) {}
+	}
+
+	return &Supervisor{
+		radio:     radio,
+		cfg:       cfg,
+		onRecover: onRecover,
+		kick:      make(chan string, 1),
+	}
+}
+
+// Run receives into out until ctx is done, recovering the radio whenever
+// it appears to be wedged. Packets keep flowing to out across recoveries.
+func (s *Supervisor) Run(ctx context.Context, out chan<- *Packet) error {
+	// buffered so a packet read just as a check cancels Rx isn't lost
+	in := make(chan *Packet, 16)
+	go func() {
+		for p := range in {
+			s.mu.Lock()
+			s.lastRx = time.Now()
+			s.mu.Unlock()
+
+			select {
+			case out <- p:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	defer close(in)
+
+	s.mu.Lock()
+	s.lastRx = time.Now()
+	s.mu.Unlock()
+
+	for {
+		rxCtx, cancel := context.WithTimeout(ctx, s.cfg.CheckInterval)
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- s.radio.RxContext(rxCtx, in) }()
+
+		var reason string
+		var cause error
+		select {
+		case reason = <-s.kick:
+			cancel()
+			<-errCh
+		case err := <-errCh:
+			cancel()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				reason, cause = "rx error", err
+			}
+		}
+
+		if reason == "" {
+			reason, cause = s.check()
+			if cause == nil {
+				continue
+			}
+		}
+
+		if err := s.recoverUntil(ctx, reason, cause); err != nil {
+			return err
+		}
+	}
+}
+
+// recoverUntil keeps resetting the radio, backing off between attempts,
+// until a recovery succeeds or ctx is done.
+func (s *Supervisor) recoverUntil(ctx context.Context, reason string, cause error) error {
+	backoff := time.Second
+
+	for {
+		err := s.recover(reason, cause)
+		if err == nil {
+			return nil
+		}
+		s.radio.log.Error("recovery failed", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s.cfg.CheckInterval)
+		reason, cause = "recovery failed", err
+	}
+}
+
+func (s *Supervisor) SendFrame(toAddr byte, msg []byte) error {
+	err := s.radio.SendFrame(toAddr, msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !errors.Is(err, ErrTimeout) {
+		s.timeouts = 0
+		return err
+	}
+
+	s.timeouts++
+	if s.timeouts >= s.cfg.MaxTimeouts {
+		s.timeouts = 0
+		select {
+		case s.kick <- fmt.Sprintf("%d consecutive timeouts", s.cfg.MaxTimeouts):
+		default:
+		}
+	}
+
+	return err
+}
+
+func (s *Supervisor) Recoveries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recoveries
+}
+
+func (s *Supervisor) check() (string, error) {
+	r := s.radio
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// registers are rewritten below, which the chip mustn't see in RX;
+	// Run's next Rx puts it back
+	if err := r.setMode(ModeStandby); err != nil {
+		return "standby", err
+	}
+
+	if err := r.verifyConfig(); err != nil {
+		return "config readback", err
+	}
+
+	if err := s.checkSync(); err != nil {
+		return "sync check", err
+	}
+
+	s.mu.Lock()
+	idle := time.Since(s.lastRx)
+	s.mu.Unlock()
+
+	if idle < s.cfg.IdleTimeout {
+		return "", nil
+	}
+
+	// RSSI is only measured in RX
+	if err := r.beginReceive(); err != nil {
+		return "begin receive", err
+	}
+	rssi, err := s.peakRSSI()
+	if err != nil {
+		return "read rssi", err
+	}
+	if rssi >= s.cfg.ActivityRSSI {
+		return "rx stalled", fmt.Errorf(
+			"nothing received for %s with rssi %d dBm",
+			idle.Round(time.Second), rssi,
+		)
+	}
+
+	return "", nil
+}
+
+// checkSync repeats the register write/readback test from Setup, then
+// restores the configured sync byte.
+func (s *Supervisor) checkSync() error {
+	r := s.radio
+
+	if err := r.sync(0xAA); err != nil {
+		return err
+	}
+	if err := r.sync(0x55); err != nil {
+		return err
+	}
+	return r.writeReg(REG_SYNCVALUE1, r.configReg(REG_SYNCVALUE1, 0x2D))
+}
+
+func (s *Supervisor) peakRSSI() (int, error) {
+	peak := -128
+	for i := 0; i < 5; i++ {
+		rssi, err := s.radio.readRSSI()
+		if err != nil {
+			return 0, err
+		}
+		peak = max(peak, rssi)
+		time.Sleep(10 * time.Millisecond)
+	}
+	return peak, nil
+}
+
+func (s *Supervisor) recover(reason string, cause error) error {
+	r := s.radio
+
+	s.mu.Lock()
+	s.recoveries++
+	ev := RecoveryEvent{
+		Time:   time.Now(),
+		Reason: reason,
+		Err:    cause,
+		Count:  s.recoveries,
+	}
+	s.mu.Unlock()
+
+	r.log.Warn("recovering radio", "reason", reason, "err", cause, "count", ev.Count)
+
+	if err := s.reinit(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.lastRx = time.Now()
+	s.mu.Unlock()
+
+	s.onRecover(ev)
+	return nil
+}
+
+// reinit resets the chip and reapplies the config, encryption key, power
+// level and address filter it had before.
+func (s *Supervisor) reinit() error {
+	r := s.radio
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config, key := r.config, r.aesKey
+
+	r.metrics.reset()
+	if err := r.setup(); err != nil {
+		return errors.Wrap(err, "setup")
+	}
+	if err := r.setConfig(config); err != nil {
+		return errors.Wrap(err, "reapply config")
+	}
+	if key != nil {
+		if err := r.setEncryptionKey(key); err != nil {
+			return errors.Wrap(err, "reapply encryption key")
+		}
+	}
+	if err := r.setPowerDBm(r.txPower); err != nil {
+		return errors.Wrap(err, "reapply power")
+	}
+	if err := r.applyAddressFilter(); err != nil {
+		return errors.Wrap(err, "reapply address filter")
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package tdma
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+type Coordinator struct {
+	radio   *rfm69.Radio
+	clock   rfm69.Clock
+	slotLen time.Duration
+
+	mu         sync.Mutex
+	owners     []byte
+	superframe byte
+}
+
+// NewCoordinator returns a coordinator for cfg, with zero fields taken
+// from DefaultConfig.
+func NewCoordinator(radio *rfm69.Radio, cfg Config) (*Coordinator, error) {
+	cfg = cfg.withDefaults()
+	if cfg.Slots < 1 || cfg.Slots > MaxSlots {
+		return nil, errors.Errorf("slots must be between 1 and %d", MaxSlots)
+	}
+
+	slotLen := SlotLength(radio, cfg)
+	if slotLen/slotUnit > 0xffff {
+		return nil, errors.Errorf("slot length %v too long", slotLen)
+	}
+
+	return &Coordinator{
+		radio:   radio,
+		clock:   radio.Clock(),
+		slotLen: slotLen,
+		owners:  make([]byte, cfg.Slots),
+	}, nil
+}
+
+func (c *Coordinator) SlotLength() time.Duration {
+	return c.slotLen
+}
+
+// Period is the length of a superframe.
+func (c *Coordinator) Period() time.Duration {
+	return time.Duration(len(c.owners)+2) * c.slotLen
+}
+
+// Assignments returns the slot held by each node.
+func (c *Coordinator) Assignments() map[byte]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := map[byte]int{}
+	for slot, owner := range c.owners {
+		if owner != 0 {
+			result[owner] = slot
+		}
+	}
+	return result
+}
+
+// Release frees addr's slot.
+func (c *Coordinator) Release(addr byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for slot, owner := range c.owners {
+		if owner == addr {
+			c.owners[slot] = 0
+		}
+	}
+}
+
+// Run sends beacons and hands out slots until ctx is done. Frames other
+// than join requests are sent to out.
+func (c *Coordinator) Run(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.radio.RxContext(ctx, in) }()
+
+	next := c.clock.Now()
+	tick := after(c.clock, 0)
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			if err := c.beacon(); err != nil {
+				return errors.Wrap(err, "send beacon")
+			}
+			next = next.Add(c.Period())
+			tick = after(c.clock, next.Sub(c.clock.Now()))
+		case p := <-in:
+			if p.Dst == c.radio.Address() && isJoin(p) {
+				c.assign(p.Src)
+				continue
+			}
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (c *Coordinator) beacon() error {
+	c.mu.Lock()
+	c.superframe++
+	b := beacon{
+		superframe: c.superframe,
+		slotLen:    c.slotLen,
+		owners:     append([]byte(nil), c.owners...),
+	}
+	c.mu.Unlock()
+
+	return c.radio.SendFrame(rfm69.RF69_BROADCAST_ADDR, b.marshal())
+}
+
+func (c *Coordinator) assign(addr byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	free := -1
+	for slot, owner := range c.owners {
+		if owner == addr {
+			return
+		}
+		if owner == 0 && free < 0 {
+			free = slot
+		}
+	}
+	if free >= 0 {
+		c.owners[free] = addr
+	}
+}
@@ -0,0 +1,218 @@
+package tdma
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+type Node struct {
+	radio *rfm69.Radio
+	clock rfm69.Clock
+	cfg   Config
+
+	mu      sync.Mutex
+	slot    int
+	queue   []*pending
+	joined  bool
+	stopped bool
+}
+
+type pending struct {
+	dst  byte
+	msg  []byte
+	done chan error
+}
+
+type eventKind int
+
+const (
+	evJoin eventKind = iota
+	evSend
+	evWake
+)
+
+type event struct {
+	at   time.Time
+	kind eventKind
+}
+
+// NewNode returns a node for cfg, with zero fields taken from
+// DefaultConfig.
+func NewNode(radio *rfm69.Radio, cfg Config) *Node {
+	return &Node{
+		radio: radio,
+		clock: radio.Clock(),
+		cfg:   cfg.withDefaults(),
+		slot:  -1,
+	}
+}
+
+// Slot returns the node's slot, once it has one.
+func (n *Node) Slot() (int, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.slot, n.slot >= 0
+}
+
+// SendFrame queues msg for the node's slot, returning once it has been
+// sent. Run must be running; once it has returned, SendFrame fails with
+// ErrStopped.
+func (n *Node) SendFrame(dst byte, msg []byte) error {
+	if len(msg) > n.radio.MaxPayload() {
+		return errors.Wrapf(rfm69.ErrPayloadTooLarge, "%d bytes", len(msg))
+	}
+
+	p := &pending{dst: dst, msg: msg, done: make(chan error, 1)}
+
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return ErrStopped
+	}
+	n.queue = append(n.queue, p)
+	n.mu.Unlock()
+
+	return <-p.done
+}
+
+// Run follows the coordinator's beacons, joining and sending queued
+// frames in the node's slot, until ctx is done. Frames received while
+// awake are sent to out.
+func (n *Node) Run(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- n.radio.RxContext(ctx, in) }()
+
+	n.mu.Lock()
+	n.stopped = false
+	n.mu.Unlock()
+	defer n.fail(ErrStopped)
+
+	var (
+		events  []event
+		wake    <-chan time.Time
+		backoff int
+		coord   byte
+	)
+
+	schedule := func() {
+		wake = nil
+		if len(events) > 0 {
+			sort.Slice(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+			wake = after(n.clock, events[0].at.Sub(n.clock.Now()))
+		}
+	}
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case p := <-in:
+			b, ok := parseBeacon(p)
+			if !ok {
+				select {
+				case out <- p:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				continue
+			}
+			if n.cfg.Coordinator != 0 && p.Src != n.cfg.Coordinator {
+				continue
+			}
+
+			frameLen := len(p.Payload)
+			if p.HasSeq {
+				frameLen++
+			}
+			coord = p.Src
+			start := p.RxTime.Add(-n.radio.Airtime(frameLen))
+			slot := b.slotOf(n.radio.Address())
+
+			n.mu.Lock()
+			if n.joined && slot < 0 {
+				backoff = rand.Intn(4)
+			}
+			n.slot, n.joined = slot, false
+			queued := len(n.queue)
+			n.mu.Unlock()
+
+			events = events[:0]
+			switch {
+			case slot >= 0 && queued > 0:
+				events = append(events, event{start.Add(time.Duration(slot+2) * b.slotLen), evSend})
+			case slot < 0 && backoff > 0:
+				backoff--
+			case slot < 0:
+				// spread joins over the first half of the slot
+				jitter := time.Duration(rand.Int63n(int64(b.slotLen / 2)))
+				events = append(events, event{start.Add(b.slotLen + jitter), evJoin})
+			}
+			if err := n.sleep(); err != nil {
+				return err
+			}
+			events = append(events, event{start.Add(b.period() - n.cfg.Guard), evWake})
+			schedule()
+
+		case <-wake:
+			ev := events[0]
+			events = events[1:]
+
+			switch ev.kind {
+			case evJoin:
+				n.mu.Lock()
+				n.joined = true
+				n.mu.Unlock()
+				if err := n.radio.SendFrame(coord, joinMagic); err != nil {
+					return errors.Wrap(err, "send join")
+				}
+			case evSend:
+				n.sendNext()
+			case evWake:
+				if err := n.radio.Wake(); err != nil {
+					return errors.Wrap(err, "wake")
+				}
+			}
+			schedule()
+		}
+	}
+}
+
+// sendNext sends the oldest queued frame.
+func (n *Node) sendNext() {
+	n.mu.Lock()
+	if len(n.queue) == 0 {
+		n.mu.Unlock()
+		return
+	}
+	p := n.queue[0]
+	n.queue = n.queue[1:]
+	n.mu.Unlock()
+
+	p.done <- n.radio.SendFrame(p.dst, p.msg)
+}
+
+func (n *Node) sleep() error {
+	return errors.Wrap(n.radio.Sleep(), "sleep")
+}
+
+func (n *Node) fail(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.stopped = true
+	for _, p := range n.queue {
+		p.done <- err
+	}
+	n.queue = nil
+}
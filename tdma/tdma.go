@@ -0,0 +1,151 @@
+// Package tdma is a slotted MAC for networks too busy for contention. A
+// coordinator broadcasts a beacon at the start of each superframe:
+//
+//	beacon | join | slot 0 | slot 1 | ... | slot n-1
+//
+// Nodes without a slot ask for one in the join slot, and the coordinator
+// lists its assignments in the next beacon. A node holds its frames until
+// its slot, sends one, and sleeps until just before the next beacon.
+//
+// Join requests are rfm69.ProtoTDMA, 'J'. Beacons are
+//
+//	0..1  rfm69.ProtoTDMA, 'D'
+//	2     superframe number
+//	3..4  slot length, in units of 100µs, big endian
+//	5..   the address owning each slot, or 0 if free
+//
+// All timing is by the radio's clock. If it has an After method, like
+// sim.VirtualClock, that is used for timers too.
+package tdma
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/pkg/errors"
+)
+
+const (
+	beaconHeaderLen = 5
+
+	// MaxSlots is as many slots as a beacon can list, leaving room for a
+	// sequence number.
+	MaxSlots = rfm69.RF69_MAX_DATA_LEN - 1 - beaconHeaderLen
+
+	slotUnit = 100 * time.Microsecond
+
+	// minSlotLen is shorter than any frame at the highest bit rate; a
+	// beacon claiming less is malformed.
+	minSlotLen = 2 * slotUnit
+)
+
+var (
+	beaconMagic = []byte{rfm69.ProtoTDMA, 'D'}
+	joinMagic   = []byte{rfm69.ProtoTDMA, 'J'}
+)
+
+var ErrStopped = errors.New("tdma stopped")
+
+type Config struct {
+	// Slots is how many slots the coordinator hands out.
+	Slots int
+
+	// MaxPayload is the largest frame the coordinator sizes slots for.
+	MaxPayload int
+
+	// Guard is added to each slot for clock error and the radio
+	// switching modes.
+	Guard time.Duration
+
+	// Coordinator is the only address a node takes beacons from; 0 takes
+	// them from anyone.
+	Coordinator byte
+}
+
+var DefaultConfig = Config{
+	Slots:      50,
+	MaxPayload: rfm69.RF69_MAX_DATA_LEN,
+	Guard:      2 * time.Millisecond,
+}
+
+// withDefaults fills in cfg's zero fields from DefaultConfig.
+func (cfg Config) withDefaults() Config {
+	if cfg.Slots == 0 {
+		cfg.Slots = DefaultConfig.Slots
+	}
+	if cfg.MaxPayload <= 0 {
+		cfg.MaxPayload = DefaultConfig.MaxPayload
+	}
+	if cfg.Guard <= 0 {
+		cfg.Guard = DefaultConfig.Guard
+	}
+	return cfg
+}
+
+// SlotLength is the length of each slot: the airtime of the largest frame
+// or beacon, plus the guard time.
+func SlotLength(radio *rfm69.Radio, cfg Config) time.Duration {
+	// any sequence number is sent on top of the message
+	seqLen := rfm69.RF69_MAX_DATA_LEN - radio.MaxPayload()
+	d := radio.Airtime(max(cfg.MaxPayload, beaconHeaderLen+cfg.Slots)+seqLen) + cfg.Guard
+	return (d + slotUnit - 1) / slotUnit * slotUnit
+}
+
+type beacon struct {
+	superframe byte
+	slotLen    time.Duration
+	owners     []byte
+}
+
+func (b *beacon) marshal() []byte {
+	buf := make([]byte, beaconHeaderLen, beaconHeaderLen+len(b.owners))
+	copy(buf, beaconMagic)
+	buf[2] = b.superframe
+	binary.BigEndian.PutUint16(buf[3:], uint16(b.slotLen/slotUnit))
+	return append(buf, b.owners...)
+}
+
+func parseBeacon(p *rfm69.Packet) (*beacon, bool) {
+	if len(p.Payload) < beaconHeaderLen || string(p.Payload[:2]) != string(beaconMagic) {
+		return nil, false
+	}
+	b := &beacon{
+		superframe: p.Payload[2],
+		slotLen:    time.Duration(binary.BigEndian.Uint16(p.Payload[3:])) * slotUnit,
+		owners:     p.Payload[beaconHeaderLen:],
+	}
+	if b.slotLen < minSlotLen || len(b.owners) == 0 || len(b.owners) > MaxSlots {
+		return nil, false
+	}
+	return b, true
+}
+
+// period is the length of a superframe.
+func (b *beacon) period() time.Duration {
+	return time.Duration(len(b.owners)+2) * b.slotLen
+}
+
+func (b *beacon) slotOf(addr byte) int {
+	for i, owner := range b.owners {
+		if owner == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+func isJoin(p *rfm69.Packet) bool {
+	return string(p.Payload) == string(joinMagic)
+}
+
+type timers interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+func after(c rfm69.Clock, d time.Duration) <-chan time.Time {
+	if t, ok := c.(timers); ok {
+		return t.After(d)
+	}
+	return time.After(d)
+}
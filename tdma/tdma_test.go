@@ -0,0 +1,182 @@
+package tdma
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+	"github.com/pkg/errors"
+)
+
+// advance runs the virtual clock at half speed, so the simulated medium,
+// which works in real time, has time to deliver frames.
+func advance(clock *sim.VirtualClock, d time.Duration) {
+	const step = 500 * time.Microsecond
+	for ; d > 0; d -= step {
+		clock.Advance(step)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSlots(t *testing.T) {
+	m := sim.NewMedium()
+	start := time.Unix(1_700_000_000, 0)
+	clock := sim.NewVirtualClock(start)
+
+	newRadio := func(addr byte) (*rfm69.Radio, *sim.Board) {
+		b := m.NewBoard()
+		r := rfm69.NewRadio(b, rfm69.WithAddress(addr), rfm69.WithClock(clock))
+		if err := r.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		return r, b
+	}
+
+	cfg := DefaultConfig
+	cfg.Slots = 8
+	cfg.Guard = 5 * time.Millisecond
+
+	cr, _ := newRadio(1)
+	coord, err := NewCoordinator(cr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slotLen, period := coord.SlotLength(), coord.Period()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rx := make(chan *rfm69.Packet, 64)
+	go func() { _ = coord.Run(ctx, rx) }()
+
+	var nodes []*Node
+	var boards []*sim.Board
+	for addr := byte(10); addr < 15; addr++ {
+		r, b := newRadio(addr)
+		n := NewNode(r, cfg)
+		go func() { _ = n.Run(ctx, make(chan *rfm69.Packet, 8)) }()
+		nodes = append(nodes, n)
+		boards = append(boards, b)
+	}
+
+	for i := 0; i < 30 && len(coord.Assignments()) < len(nodes); i++ {
+		advance(clock, period)
+	}
+	advance(clock, period)
+
+	slots := coord.Assignments()
+	if len(slots) != len(nodes) {
+		t.Fatalf("assignments = %v", slots)
+	}
+	for i, n := range nodes {
+		addr := byte(10 + i)
+		if slot, ok := n.Slot(); !ok || slot != slots[addr] {
+			t.Errorf("0x%02x has slot %d, coordinator says %d", addr, slot, slots[addr])
+		}
+	}
+
+	errs := make(chan error, 2*len(nodes))
+	for i, n := range nodes {
+		for j := 0; j < 2; j++ {
+			go func(i, j int, n *Node) {
+				errs <- n.SendFrame(1, []byte(fmt.Sprintf("%d/%d", i, j)))
+			}(i, j, n)
+		}
+	}
+	advance(clock, 3*period)
+
+	for i := 0; i < 2*len(nodes); i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		default:
+			t.Fatal("frame still queued")
+		}
+	}
+
+	for i := 0; i < 2*len(nodes); i++ {
+		p := <-rx
+		// frames end within their sender's slot, give or take the guard
+		// time, since the medium doesn't run on the virtual clock
+		at := p.RxTime.Sub(start) % period
+		slot := slots[p.Src]
+		lo, hi := time.Duration(slot+2)*slotLen-cfg.Guard, time.Duration(slot+3)*slotLen
+		if at < lo || at > hi {
+			t.Errorf("%q from 0x%02x at %v, slot is %v-%v", p.Payload, p.Src, at, lo, hi)
+		}
+	}
+
+	// between beacons, with nothing to send, nodes sleep
+	for (clock.Now().Sub(start) % period) < time.Duration(cfg.Slots)*slotLen {
+		advance(clock, slotLen/2)
+	}
+	for i, b := range boards {
+		if !b.Asleep() {
+			t.Errorf("0x%02x awake", 10+i)
+		}
+	}
+}
+
+func TestMalformedBeacon(t *testing.T) {
+	for _, payload := range [][]byte{
+		{rfm69.ProtoTDMA, 'D', 0, 0, 0},
+		{rfm69.ProtoTDMA, 'D', 0, 0, 0, 10},
+		{rfm69.ProtoTDMA, 'D', 0, 0, 20},
+	} {
+		if _, ok := parseBeacon(&rfm69.Packet{Payload: payload}); ok {
+			t.Errorf("accepted % x", payload)
+		}
+	}
+}
+
+func TestFullBeaconWithSeq(t *testing.T) {
+	m := sim.NewMedium()
+	r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(1), rfm69.WithSequenceNumbers())
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig
+	cfg.Slots = MaxSlots
+	coord, err := NewCoordinator(r, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := coord.beacon(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendAfterStop(t *testing.T) {
+	m := sim.NewMedium()
+	r := rfm69.NewRadio(m.NewBoard(), rfm69.WithAddress(10))
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a zero Config falls back to the defaults
+	n := NewNode(r, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = n.Run(ctx, make(chan *rfm69.Packet))
+
+	if err := n.SendFrame(1, make([]byte, r.MaxPayload()+1)); !errors.Is(err, rfm69.ErrPayloadTooLarge) {
+		t.Errorf("oversize send: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- n.SendFrame(1, []byte("late")) }()
+	select {
+	case err := <-done:
+		if err != ErrStopped {
+			t.Errorf("send after stop: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send after stop blocked")
+	}
+}
@@ -0,0 +1,95 @@
+package rfm69
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+const fxosc = 32_000_000
+
+type Timeouts struct {
+	// ModeReady bounds the wait for a mode transition to complete.
+	ModeReady time.Duration
+
+	// The deadline for PacketSent is AirtimeFactor times the frame
+	// airtime plus PacketSentMargin.
+	AirtimeFactor    int
+	PacketSentMargin time.Duration
+
+	// PollInterval is how long to sleep between status register reads.
+	PollInterval time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	ModeReady:        50 * time.Millisecond,
+	AirtimeFactor:    2,
+	PacketSentMargin: 20 * time.Millisecond,
+	PollInterval:     200 * time.Microsecond,
+}
+
+func (r *Radio) waitForFlag(addr byte, mask byte, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		flags, err := r.readReg(addr)
+		if err != nil {
+			return err
+		}
+		if flags&mask != 0x00 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			r.metrics.timeout()
+			return errors.Wrapf(ErrTimeout, "%s after %s", FormatRegister(addr, mask), timeout)
+		}
+		time.Sleep(r.timeouts.PollInterval)
+	}
+}
+
+func (r *Radio) configReg(addr byte, dflt byte) byte {
+	if val, ok := r.regs[addr]; ok {
+		return val
+	}
+	return dflt
+}
+
+func (r *Radio) BitRate() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.bitRate()
+}
+
+func (r *Radio) bitRate() int {
+	div := int(r.configReg(REG_BITRATEMSB, RF_BITRATEMSB_4800))<<8 |
+		int(r.configReg(REG_BITRATELSB, RF_BITRATELSB_4800))
+	return fxosc / div
+}
+
+// Airtime returns the on-air duration of a frame carrying msgLen bytes of
+// payload: preamble, sync word, length, address and control bytes, and CRC.
+func (r *Radio) Airtime(msgLen int) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.airtime(msgLen)
+}
+
+func (r *Radio) airtime(msgLen int) time.Duration {
+	preamble := int(r.configReg(REG_PREAMBLEMSB, RF_PREAMBLESIZE_MSB_VALUE))<<8 |
+		int(r.configReg(REG_PREAMBLELSB, RF_PREAMBLESIZE_LSB_VALUE))
+
+	syncConfig := r.configReg(REG_SYNCCONFIG, RF_SYNC_ON|RF_SYNC_SIZE_4)
+	syncSize := 0
+	if syncConfig&RF_SYNC_ON != 0 {
+		syncSize = int(syncConfig>>3&0x07) + 1
+	}
+
+	crc := 0
+	if r.configReg(REG_PACKETCONFIG1, RF_PACKET1_CRC_ON)&RF_PACKET1_CRC_ON != 0 {
+		crc = 2
+	}
+
+	n := preamble + syncSize + 1 + 3 + msgLen + crc
+	return time.Duration(n*8) * time.Second / time.Duration(r.bitRate())
+}
@@ -0,0 +1,76 @@
+package timesync
+
+import "time"
+
+// sample is the master's clock minus ours, at local time.
+type sample struct {
+	local  time.Time
+	offset time.Duration
+}
+
+// filter fits a line through the most recent samples, giving the offset
+// and drift. A sample far off the line is dropped as an outlier, unless
+// several in a row are, which means the master's clock stepped.
+type filter struct {
+	size    int
+	maxErr  time.Duration
+	samples []sample
+	misses  int
+
+	ref    time.Time
+	offset time.Duration
+	drift  float64 // seconds gained on us per second
+}
+
+const maxMisses = 3
+
+func (f *filter) add(local time.Time, offset time.Duration) bool {
+	if len(f.samples) >= 2 {
+		if e := offset - f.at(local); e > f.maxErr || e < -f.maxErr {
+			f.misses++
+			if f.misses < maxMisses {
+				return false
+			}
+			f.samples = f.samples[:0]
+		}
+	}
+	f.misses = 0
+
+	f.samples = append(f.samples, sample{local, offset})
+	if len(f.samples) > f.size {
+		f.samples = f.samples[1:]
+	}
+	f.fit()
+	return true
+}
+
+func (f *filter) fit() {
+	ref, base := f.samples[0].local, f.samples[0].offset
+	n := float64(len(f.samples))
+
+	var mx, my float64
+	for _, s := range f.samples {
+		mx += s.local.Sub(ref).Seconds()
+		my += float64(s.offset - base)
+	}
+	mx, my = mx/n, my/n
+
+	var sxx, sxy float64
+	for _, s := range f.samples {
+		dx := s.local.Sub(ref).Seconds() - mx
+		sxx += dx * dx
+		sxy += dx * (float64(s.offset-base) - my)
+	}
+
+	f.ref = ref.Add(time.Duration(mx * float64(time.Second)))
+	f.offset = base + time.Duration(my)
+	f.drift = 0
+	if sxx > 0 {
+		f.drift = sxy / sxx / float64(time.Second)
+	}
+}
+
+// at returns the offset at local time t.
+func (f *filter) at(t time.Time) time.Duration {
+	return f.offset + time.Duration(f.drift*float64(t.Sub(f.ref)))
+}
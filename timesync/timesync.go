@@ -0,0 +1,208 @@
+// Package timesync aligns nodes' clocks to a master, usually the gateway,
+// over the radio.
+//
+// The master broadcasts beacons carrying the time, by its radio's clock,
+// at which each went on air:
+//
+//	0..1   rfm69.ProtoTimesync, 'S'
+//	2      beacon number
+//	3..10  master's time, unix nanoseconds, big endian
+//
+// A node takes the time its own radio signalled PayloadReady, which is
+// one airtime after the master's timestamp, and tracks the offset and
+// drift between the two clocks.
+package timesync
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+)
+
+const beaconLen = 11
+
+var beaconMagic = []byte{rfm69.ProtoTimesync, 'S'}
+
+type Master struct {
+	radio *rfm69.Radio
+
+	mu  sync.Mutex
+	seq byte
+}
+
+func NewMaster(radio *rfm69.Radio) *Master {
+	return &Master{radio: radio}
+}
+
+// Beacon broadcasts one beacon.
+func (m *Master) Beacon() error {
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	msg := make([]byte, beaconLen)
+	copy(msg, beaconMagic)
+	msg[2] = seq
+
+	return m.radio.SendTimestamped(rfm69.RF69_BROADCAST_ADDR, msg, func(msg []byte, now time.Time) {
+		binary.BigEndian.PutUint64(msg[3:], uint64(now.UnixNano()))
+	})
+}
+
+// Run sends a beacon every interval until ctx is done.
+func (m *Master) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Beacon(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type Config struct {
+	// Master is the only address beacons are taken from; 0 takes them
+	// from anyone.
+	Master byte
+
+	// Window is how many beacons the offset and drift are fitted over.
+	Window int
+
+	// MaxError is how far off the fit a beacon can be before it is
+	// treated as an outlier.
+	MaxError time.Duration
+}
+
+var DefaultConfig = Config{
+	Window:   8,
+	MaxError: 5 * time.Millisecond,
+}
+
+type Stats struct {
+	Beacons  uint64
+	Rejected uint64
+
+	// Offset is the master's clock minus ours, as of the last beacon.
+	Offset time.Duration
+
+	// Drift is how fast the master's clock runs relative to ours, in
+	// parts per million.
+	Drift float64
+}
+
+type Node struct {
+	radio *rfm69.Radio
+	cfg   Config
+
+	mu     sync.Mutex
+	filter filter
+	stats  Stats
+}
+
+// NewNode returns a node following cfg, with a Window under 2 or a
+// MaxError that isn't positive replaced by DefaultConfig's.
+func NewNode(radio *rfm69.Radio, cfg Config) *Node {
+	if cfg.Window < 2 {
+		cfg.Window = DefaultConfig.Window
+	}
+	if cfg.MaxError <= 0 {
+		cfg.MaxError = DefaultConfig.MaxError
+	}
+
+	return &Node{
+		radio:  radio,
+		cfg:    cfg,
+		filter: filter{size: cfg.Window, maxErr: cfg.MaxError},
+	}
+}
+
+// Synced reports whether a beacon has been received.
+func (n *Node) Synced() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.filter.samples) > 0
+}
+
+// Now returns the master's time, or the radio clock's until Synced.
+func (n *Node) Now() time.Time {
+	local := n.radio.Clock().Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.filter.samples) == 0 {
+		return local
+	}
+	return local.Add(n.filter.at(local))
+}
+
+func (n *Node) Stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// Handle takes in p if it is a beacon, reporting whether it was.
+func (n *Node) Handle(p *rfm69.Packet) bool {
+	if len(p.Payload) != beaconLen || string(p.Payload[:2]) != string(beaconMagic) {
+		return false
+	}
+	if n.cfg.Master != 0 && p.Src != n.cfg.Master || p.RxTime.IsZero() {
+		return true
+	}
+
+	frameLen := len(p.Payload)
+	if p.HasSeq {
+		frameLen++
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(p.Payload[3:])))
+	offset := sent.Add(n.radio.Airtime(frameLen)).Sub(p.RxTime)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.stats.Beacons++
+	if !n.filter.add(p.RxTime, offset) {
+		n.stats.Rejected++
+		return true
+	}
+	n.stats.Offset = n.filter.at(p.RxTime)
+	n.stats.Drift = n.filter.drift * 1e6
+	return true
+}
+
+// RxContext runs the radio's receiver, taking in beacons and sending
+// everything else to out.
+func (n *Node) RxContext(ctx context.Context, out chan<- *rfm69.Packet) error {
+	in := make(chan *rfm69.Packet, 16)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- n.radio.RxContext(ctx, in) }()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case p := <-in:
+			if n.Handle(p) {
+				continue
+			}
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
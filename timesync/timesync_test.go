@@ -0,0 +1,166 @@
+package timesync
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/rfm69"
+	"github.com/minor-industries/rfm69/sim"
+)
+
+func TestFilter(t *testing.T) {
+	f := filter{size: 4, maxErr: time.Millisecond}
+	start := time.Unix(1000, 0)
+
+	// the master gains 100µs a second on us
+	for i := 0; i < 4; i++ {
+		local := start.Add(time.Duration(i) * time.Second)
+		f.add(local, 2*time.Second+time.Duration(i)*100*time.Microsecond)
+	}
+	if d := f.drift * 1e6; d < 99.9 || d > 100.1 {
+		t.Errorf("drift = %f ppm", d)
+	}
+	if got := f.at(start.Add(10 * time.Second)); got != 2*time.Second+time.Millisecond {
+		t.Errorf("offset = %v", got)
+	}
+
+	if f.add(start.Add(4*time.Second), 3*time.Second) {
+		t.Error("outlier accepted")
+	}
+	for i := 1; i < maxMisses; i++ {
+		f.add(start.Add(time.Duration(4+i)*time.Second), 3*time.Second)
+	}
+	if got := f.at(start.Add(6 * time.Second)); got != 3*time.Second {
+		t.Errorf("offset after step = %v", got)
+	}
+}
+
+func TestSyncWithSkew(t *testing.T) {
+	// the node's clock is 3s ahead and runs 150ppm fast
+	start := time.Unix(1_700_000_000, 0)
+	local := func(master time.Time) time.Time {
+		d := master.Sub(start)
+		return start.Add(3*time.Second + d + time.Duration(float64(d)*150e-6))
+	}
+
+	clock := sim.NewVirtualClock(local(start))
+	nr := rfm69.NewRadio(sim.NewMedium().NewBoard(), rfm69.WithAddress(2), rfm69.WithClock(clock))
+	if err := nr.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a zero Window and MaxError fall back to the defaults
+	node := NewNode(nr, Config{Master: 1})
+	if node.Synced() {
+		t.Fatal("synced before any beacon")
+	}
+
+	airtime := nr.Airtime(beaconLen)
+	var sent time.Time
+	for i := 0; i < 20; i++ {
+		sent = start.Add(time.Duration(i) * 100 * time.Millisecond)
+		msg := make([]byte, beaconLen)
+		copy(msg, beaconMagic)
+		msg[2] = byte(i)
+		binary.BigEndian.PutUint64(msg[3:], uint64(sent.UnixNano()))
+
+		node.Handle(&rfm69.Packet{Src: 1, Payload: msg, RxTime: local(sent.Add(airtime))})
+	}
+
+	// a second after the last beacon
+	now := sent.Add(time.Second)
+	clock.Advance(local(now).Sub(clock.Now()))
+
+	if err := node.Now().Sub(now); err > time.Microsecond || err < -time.Microsecond {
+		t.Errorf("clock off by %v", err)
+	}
+	if s := node.Stats(); s.Beacons != 20 || s.Rejected != 0 || s.Drift > -149.9 || s.Drift < -150.1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestSyncOverRadio(t *testing.T) {
+	// frames are timed by a virtual clock, so they arrive exactly one
+	// airtime after they are stamped, as on the chip
+	m := sim.NewMedium()
+	clock := sim.NewVirtualClock(time.Unix(1_700_000_000, 0))
+	m.SetClock(clock)
+
+	// frames take as long as the test takes to advance the clock
+	timeouts := rfm69.DefaultTimeouts
+	timeouts.PacketSentMargin = time.Second
+
+	mr := rfm69.NewRadio(m.NewBoard(),
+		rfm69.WithAddress(1),
+		rfm69.WithClock(clock),
+		rfm69.WithTimeouts(timeouts),
+	)
+	if err := mr.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	nr := rfm69.NewRadio(
+		m.NewBoard(),
+		rfm69.WithAddress(2),
+		rfm69.WithClock(&sim.SkewedClock{Start: clock.Now(), Offset: 3 * time.Second, PPM: 150, Base: clock}),
+	)
+	if err := nr.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig
+	cfg.Master = 1
+	cfg.Window = 16
+	node := NewNode(nr, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = node.RxContext(ctx, make(chan *rfm69.Packet)) }()
+	master := NewMaster(mr)
+
+	// beacon sends a beacon, then runs the clock until it has been
+	// delivered, pausing at each delivery so the receiver stamps it at
+	// that time
+	beacon := func() {
+		t.Helper()
+		sent := make(chan error, 1)
+		go func() { sent <- master.Beacon() }()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			if next, ok := clock.Next(); ok {
+				clock.Advance(next.Sub(clock.Now()))
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			select {
+			case err := <-sent:
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			default:
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("beacon not sent")
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		beacon()
+		time.Sleep(time.Millisecond)
+		clock.Advance(100 * time.Millisecond)
+	}
+	clock.Advance(time.Second)
+
+	if err := node.Now().Sub(clock.Now()); err > time.Microsecond || err < -time.Microsecond {
+		t.Errorf("clock off by %v, %+v", err, node.Stats())
+	}
+	if s := node.Stats(); s.Beacons != 20 || s.Rejected != 0 || s.Drift > -149.9 || s.Drift < -150.1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
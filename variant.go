@@ -0,0 +1,69 @@
+package rfm69
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// Variant is the module's PA wiring. It cannot be read back from the
+// chip: the W/CW and HW/HCW modules carry the same silicon but route
+// different PA pins to the antenna.
+type Variant int
+
+const (
+	VariantHW Variant = iota + 1 // RFM69HW/HCW: PA1+PA2, up to +20 dBm
+	VariantW                     // RFM69W/CW: PA0 only, up to +13 dBm
+)
+
+func (v Variant) String() string {
+	switch v {
+	case VariantHW:
+		return "HW"
+	case VariantW:
+		return "W"
+	default:
+		return fmt.Sprintf("Variant(%d)", int(v))
+	}
+}
+
+func (v Variant) PowerRange() (int, int) {
+	if v == VariantW {
+		return -18, 13
+	}
+	return -2, 20
+}
+
+// known RegVersion values for the SX1231/SX1231H
+var supportedVersions = map[byte]bool{
+	0x21: true,
+	0x22: true,
+	0x23: true,
+	0x24: true,
+}
+
+func (r *Radio) Variant() Variant {
+	return r.variant
+}
+
+// Version returns the silicon version read during Setup.
+func (r *Radio) Version() byte {
+	return r.version
+}
+
+func (r *Radio) checkVersion() error {
+	version, err := r.readReg(REG_VERSION)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version == 0x00 || version == 0xFF:
+		return errors.Wrapf(ErrNotResponding, "version 0x%02x", version)
+	case !supportedVersions[version]:
+		return errors.Wrapf(ErrUnsupportedChip, "version 0x%02x", version)
+	}
+
+	r.version = version
+	r.log.Info("chip identified", "version", version, "variant", r.variant)
+	return nil
+}